@@ -0,0 +1,164 @@
+package sqlrange
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"reflect"
+)
+
+// AssembleOneToMany executes a one-to-many join, where the columns of the parent
+// are repeated for each of its children, and returns a sequence of the parent
+// values assembled from its rows, for example:
+//
+//	type Order struct {
+//	  ID    int64  `sql:"order_id"`
+//	  Buyer string `sql:"buyer"`
+//	  Items []Item
+//	}
+//
+//	type Item struct {
+//	  OrderID  int64  `sql:"order_id"`
+//	  Name     string `sql:"item"`
+//	  Quantity int    `sql:"quantity"`
+//	}
+//
+//	for order, err := range sqlrange.AssembleOneToMany(ctx, db, `
+//	  SELECT o.order_id, o.buyer, i.item, i.quantity
+//	  FROM orders o JOIN items i ON i.order_id = o.order_id
+//	  ORDER BY o.order_id`,
+//	  func(o Order) int64 { return o.ID },
+//	  func(o *Order) *[]Item { return &o.Items },
+//	) {
+//	  ...
+//	}
+//
+// The query is executed once, and each row is scanned once into both a Parent
+// and a Child value, whose fields are resolved with the context hooks (see
+// [WithTags] and [WithFieldResolver]). Columns mapped to fields of both types
+// are assigned to both, and columns which are not mapped to any field are
+// ignored. Consecutive rows producing the same key are grouped into a single
+// parent, whose children are appended to the slice returned by the children
+// function. The parent fields are taken from the first row of each group. The
+// query must therefore order the rows by the key of the parents, otherwise a
+// parent appears multiple times in the sequence.
+//
+// As with [CompileScanner], scan options and the options of struct field tags
+// do not apply.
+func AssembleOneToMany[Parent, Child any, Key comparable](ctx context.Context, q Queryable, query string, key func(Parent) Key, children func(*Parent) *[]Child, args ...any) iter.Seq2[Parent, error] {
+	return func(yield func(Parent, error) bool) {
+		var zero Parent
+		hooks := hooksFrom(ctx)
+		yield = countYield(&hooks, yield, false)
+
+		query, err := hooks.query(ctx, query)
+		if err == nil {
+			err = hooks.validate(query, args)
+		}
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		hooks.incQueries()
+		start := hooks.start()
+		rows, err := q.QueryContext(ctx, query, args...)
+		hooks.observe(query, start, err)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		columns, err := rows.Columns()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		var parent, next Parent
+		var child Child
+		nextValue := reflect.ValueOf(&next).Elem()
+		childValue := reflect.ValueOf(&child).Elem()
+
+		scanArgs := make([]any, len(columns))
+		columnFields := make([]reflect.StructField, len(columns))
+		// shared is the list of fields of the parent and child mapped to the
+		// same column, which are copied to the child after scanning each row.
+		var shared [][2]reflect.Value
+
+		for _, f := range hooks.fields(nextValue.Type()) {
+			if columnIndex := f.columnIndex(columns); columnIndex >= 0 {
+				scanArgs[columnIndex] = scanDest(nextValue.FieldByIndex(f.field.Index))
+				columnFields[columnIndex] = f.field
+			}
+		}
+		for _, f := range hooks.fields(childValue.Type()) {
+			columnIndex := f.columnIndex(columns)
+			if columnIndex < 0 {
+				continue
+			}
+			fieldValue := childValue.FieldByIndex(f.field.Index)
+			if scanArgs[columnIndex] == nil {
+				scanArgs[columnIndex] = scanDest(fieldValue)
+				columnFields[columnIndex] = f.field
+				continue
+			}
+			parentField := columnFields[columnIndex]
+			if parentField.Type != f.field.Type {
+				yield(zero, fmt.Errorf("column %q is mapped to fields of different types: %s.%s of type %s and %s.%s of type %s",
+					columns[columnIndex],
+					nextValue.Type(), parentField.Name, parentField.Type,
+					childValue.Type(), f.field.Name, f.field.Type,
+				))
+				return
+			}
+			shared = append(shared, [2]reflect.Value{nextValue.FieldByIndex(parentField.Index), fieldValue})
+		}
+
+		for i := range scanArgs {
+			if scanArgs[i] == nil {
+				scanArgs[i] = discard{}
+			}
+		}
+
+		var zeroChild Child
+		var parentKey Key
+		var found bool
+
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !rows.Next() {
+				break
+			}
+			next, child = zero, zeroChild
+			if err := rows.Scan(scanArgs...); err != nil {
+				yield(zero, scanError(rows, columns, scanArgs, columnFields, err))
+				return
+			}
+			hooks.incRows()
+			for _, f := range shared {
+				f[1].Set(f[0])
+			}
+			if k := key(next); !found || k != parentKey {
+				if found && !yield(parent, nil) {
+					return
+				}
+				parent, parentKey, found = next, k, true
+			}
+			list := children(&parent)
+			*list = append(*list, child)
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+			return
+		}
+		if found {
+			yield(parent, nil)
+		}
+	}
+}
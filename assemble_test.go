@@ -0,0 +1,92 @@
+package sqlrange_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+func TestAssembleOneToMany(t *testing.T) {
+	type item struct {
+		OrderID  int64  `sql:"order_id"`
+		Name     string `sql:"item"`
+		Quantity int    `sql:"quantity"`
+	}
+
+	type order struct {
+		ID    int64  `sql:"order_id"`
+		Buyer string `sql:"buyer"`
+		Items []item
+	}
+
+	queries := 0
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		queries++
+		return newStubRows([]string{"order_id", "buyer", "item", "quantity"},
+			[]driver.Value{int64(1), "Alice", "apple", int64(2)},
+			[]driver.Value{int64(1), "Alice", "banana", int64(1)},
+			[]driver.Value{int64(2), "Bob", "cherry", int64(12)},
+		), nil
+	})
+	defer db.Close()
+
+	metrics := new(counters)
+	ctx := sqlrange.WithMetrics(context.Background(), metrics)
+
+	var orders []order
+	for o, err := range sqlrange.AssembleOneToMany(ctx, db,
+		`SELECT order_id, buyer, item, quantity FROM orders JOIN items USING (order_id) ORDER BY order_id`,
+		func(o order) int64 { return o.ID },
+		func(o *order) *[]item { return &o.Items },
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders = append(orders, o)
+	}
+
+	expect := []order{
+		{ID: 1, Buyer: "Alice", Items: []item{{1, "apple", 2}, {1, "banana", 1}}},
+		{ID: 2, Buyer: "Bob", Items: []item{{2, "cherry", 12}}},
+	}
+	if !reflect.DeepEqual(orders, expect) {
+		t.Errorf("expect %v, got %v", expect, orders)
+	}
+	if queries != 1 {
+		t.Errorf("expect 1 query, got %d", queries)
+	}
+	if n := metrics.rows.Load(); n != 3 {
+		t.Errorf("expect 3 rows scanned, got %d", n)
+	}
+}
+
+func TestAssembleOneToManyMismatch(t *testing.T) {
+	type item struct {
+		OrderID string `sql:"order_id"`
+	}
+
+	type order struct {
+		ID    int64 `sql:"order_id"`
+		Items []item
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"order_id"}, []driver.Value{int64(1)}), nil
+	})
+	defer db.Close()
+
+	for _, err := range sqlrange.AssembleOneToMany(context.Background(), db, `SELECT order_id FROM items`,
+		func(o order) int64 { return o.ID },
+		func(o *order) *[]item { return &o.Items },
+	) {
+		if err == nil || !strings.Contains(err.Error(), `"order_id"`) {
+			t.Errorf("expect an error naming the order_id column, got %v", err)
+		}
+		return
+	}
+	t.Error("expect an error for a column mapped to fields of different types")
+}
@@ -0,0 +1,407 @@
+package sqlrange
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Placeholder represents the style of placeholders used to reference query
+// arguments, which differs between databases.
+type Placeholder int
+
+const (
+	// Question is the placeholder style using question marks (?), used by
+	// databases like MySQL and SQLite.
+	Question Placeholder = iota
+	// Dollar is the placeholder style using numbered parameters ($1, $2, ...),
+	// used by Postgres.
+	Dollar
+)
+
+// Nth returns the placeholder for the n-th argument of a query, starting at 1.
+func (p Placeholder) Nth(n int) string {
+	if p == Dollar {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// Dialect describes the differences in SQL syntax between databases that the
+// package needs to account for when generating queries.
+//
+// Programs may derive custom dialects from the predefined values, for example
+// to change how identifiers are quoted:
+//
+//	dialect := sqlrange.Postgres
+//	dialect.QuoteIdentifier = func(name string) string { return name }
+type Dialect struct {
+	// QuoteIdentifier is the function used to quote the table and column
+	// names embedded in generated queries. When nil, identifiers are not
+	// quoted.
+	QuoteIdentifier func(name string) string
+	// Placeholder is the style of placeholders in generated queries.
+	Placeholder Placeholder
+	// Returning is true if the database supports RETURNING clauses on INSERT
+	// statements, see [InsertReturning].
+	Returning bool
+}
+
+var (
+	// MySQL is the dialect of MySQL databases, it quotes identifiers with
+	// backticks, uses question mark placeholders, and does not support
+	// RETURNING clauses.
+	MySQL = Dialect{QuoteIdentifier: QuoteBackticks, Placeholder: Question}
+	// Postgres is the dialect of Postgres databases, it quotes identifiers with
+	// double quotes and uses dollar placeholders.
+	Postgres = Dialect{QuoteIdentifier: QuoteDoubleQuotes, Placeholder: Dollar, Returning: true}
+	// SQLite is the dialect of SQLite databases, it quotes identifiers with
+	// double quotes and uses question mark placeholders. RETURNING clauses are
+	// supported since SQLite 3.35.
+	SQLite = Dialect{QuoteIdentifier: QuoteDoubleQuotes, Placeholder: Question, Returning: true}
+)
+
+// QuoteDoubleQuotes quotes an identifier with double quotes, as defined by the
+// SQL standard. Double quotes within the identifier are escaped by doubling
+// them.
+func QuoteDoubleQuotes(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteBackticks quotes an identifier with backticks, as done by MySQL.
+// Backticks within the identifier are escaped by doubling them.
+func QuoteBackticks(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quote quotes a column name.
+func (d Dialect) quote(name string) string {
+	if d.QuoteIdentifier == nil {
+		return name
+	}
+	return d.QuoteIdentifier(name)
+}
+
+// quoteTable quotes a table name, which may be qualified by a schema name.
+func (d Dialect) quoteTable(name string) string {
+	if d.QuoteIdentifier == nil {
+		return name
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = d.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// ColumnList returns the comma-separated list of columns that the fields of
+// Row are mapped to, in the order defined by [Fields] and quoted according to
+// the dialect.
+func ColumnList[Row any](dialect Dialect) string {
+	var b strings.Builder
+	for columnName := range Fields(reflect.TypeOf(new(Row)).Elem()) {
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(dialect.quote(columnName))
+	}
+	return b.String()
+}
+
+// InsertQuery returns a query inserting a Row value in a table, for example:
+//
+//	INSERT INTO "table" ("col1", "col2") VALUES ($1, $2)
+//
+// The columns are listed in the order defined by [Fields], which matches the
+// order of the arguments generated by default by [Exec] and [ExecContext], so
+// the query can be used directly to insert a sequence of rows:
+//
+//	query := sqlrange.InsertQuery[RowType](sqlrange.Postgres, "table")
+//	for r, err := range sqlrange.ExecContext(ctx, tx, query, rows) {
+//	  ...
+//	}
+func InsertQuery[Row any](dialect Dialect, table string) string {
+	var columns []string
+	for columnName := range Fields(reflect.TypeOf(new(Row)).Elem()) {
+		columns = append(columns, columnName)
+	}
+	return insertQuery(dialect, table, columns)
+}
+
+func insertQuery(dialect Dialect, table string, columns []string) string {
+	return insertRowsQuery(dialect, table, columns, 1)
+}
+
+// insertRowsQuery returns a query inserting the given number of rows in a
+// table, with the placeholders of each row numbered in sequence.
+func insertRowsQuery(dialect Dialect, table string, columns []string, rows int) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	b.WriteString(dialect.quoteTable(table))
+	b.WriteString(" (")
+	for i, column := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(dialect.quote(column))
+	}
+	b.WriteString(") VALUES ")
+	b.WriteString(PlaceholderRows(len(columns), rows, dialect.Placeholder))
+	return b.String()
+}
+
+// UpsertMySQL returns a query inserting a Row value in a table of a MySQL
+// database, or updating the row which has the same primary or unique key, for
+// example:
+//
+//	INSERT INTO `table` (`id`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)
+//
+// The update columns are the columns modified when the row already exists, all
+// the columns that the fields of Row are mapped to are updated when none are
+// given. As with [InsertQuery], the order of the placeholders matches the order
+// of the arguments generated by default by [Exec] and [ExecContext].
+func UpsertMySQL[Row any](table string, update ...string) string {
+	if len(update) == 0 {
+		for columnName := range Fields(reflect.TypeOf(new(Row)).Elem()) {
+			update = append(update, columnName)
+		}
+	}
+	var b strings.Builder
+	b.WriteString(InsertQuery[Row](MySQL, table))
+	b.WriteString(" ON DUPLICATE KEY UPDATE ")
+	for i, column := range update {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		column = MySQL.quote(column)
+		b.WriteString(column)
+		b.WriteString(" = VALUES(")
+		b.WriteString(column)
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// UpdateQuery returns a query updating the given columns of the rows of a table
+// matching the where columns, for example:
+//
+//	UPDATE "table" SET "col1" = $1, "col2" = $2 WHERE "id" = $3
+//
+// The placeholders are numbered in the order of the columns followed by the
+// where columns, which matches the order of the arguments generated by the
+// [ExecArgsSubset] option. The functions are intended to be used together to
+// update only some of the columns of each row:
+//
+//	present := func(u User) []string { return u.ChangedColumns() }
+//	for r, err := range sqlrange.ExecSlice(ctx, tx, "", users,
+//	  sqlrange.ExecArgsSubset(present, "id"),
+//	  sqlrange.ExecQuery(func(_ string, u User) string {
+//	    return sqlrange.UpdateQuery(sqlrange.Postgres, "users", present(u), "id")
+//	  }),
+//	) {
+//	  ...
+//	}
+//
+// Note that a query without columns to update is not valid SQL, programs must
+// handle the case where the list of columns is empty.
+func UpdateQuery(dialect Dialect, table string, columns []string, where ...string) string {
+	var b strings.Builder
+	b.WriteString("UPDATE ")
+	b.WriteString(dialect.quoteTable(table))
+	b.WriteString(" SET ")
+	n := 0
+	for _, column := range columns {
+		if n++; n > 1 {
+			b.WriteString(", ")
+		}
+		b.WriteString(dialect.quote(column))
+		b.WriteString(" = ")
+		b.WriteString(dialect.Placeholder.Nth(n))
+	}
+	for i, column := range where {
+		if i == 0 {
+			b.WriteString(" WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+		n++
+		b.WriteString(dialect.quote(column))
+		b.WriteString(" = ")
+		b.WriteString(dialect.Placeholder.Nth(n))
+	}
+	return b.String()
+}
+
+// WhereEquals returns a condition matching the columns of the non-zero fields
+// of a filter value, and the arguments to pass along with it, for example:
+//
+//	where, args := sqlrange.WhereEquals(sqlrange.Postgres, User{Name: "Alice", Age: 42})
+//	// where: "name" = $1 AND "age" = $2
+//	query := `SELECT * FROM users`
+//	if where != "" {
+//	  query += ` WHERE ` + where
+//	}
+//	for user, err := range sqlrange.Query[User](db, query, args...) {
+//	  ...
+//	}
+//
+// The columns are listed in the order defined by [Fields], and the arguments
+// are generated from the fields the same way as for [Exec] and [ExecContext].
+// Placeholders are numbered from 1, [Renumber] can be used to combine the
+// condition with other arguments. The condition is empty when all the fields
+// are zero, which programs must handle since an empty WHERE clause is not valid
+// SQL.
+//
+// The function panics if the fields have invalid tag options, for example when
+// no sentinel value was registered for the type of a field with the "sentinel"
+// option.
+func WhereEquals[Row any](dialect Dialect, filter Row) (clause string, args []any) {
+	var b strings.Builder
+	val := reflect.ValueOf(filter)
+
+	for _, f := range cachedFieldsOf(val.Type()) {
+		fieldValue := val.FieldByIndex(f.field.Index)
+		if fieldValue.IsZero() {
+			continue
+		}
+		arg, err := fieldArg(f)
+		if err != nil {
+			panic(err)
+		}
+		if len(args) > 0 {
+			b.WriteString(" AND ")
+		}
+		args = append(args, arg(fieldValue))
+		b.WriteString(dialect.quote(f.name))
+		b.WriteString(" = ")
+		b.WriteString(dialect.Placeholder.Nth(len(args)))
+	}
+
+	return b.String(), args
+}
+
+// InValues returns the placeholders and arguments to use in an IN clause
+// matching the values of a field of each row, for example:
+//
+//	placeholders, args := sqlrange.InValues(sqlrange.Postgres, users, func(u User) int64 {
+//	  return u.ID
+//	})
+//	query := `SELECT * FROM orders WHERE user_id IN (` + placeholders + `)`
+//	for order, err := range sqlrange.Query[Order](db, query, args...) {
+//	  ...
+//	}
+//
+// The placeholders are comma-separated, one for each row, in the style of the
+// dialect. Numbered placeholders start at 1, so the arguments must be the first
+// of the query. Note that an empty IN list is not valid SQL, programs must
+// handle the case where the list of rows is empty.
+func InValues[Row, T any](dialect Dialect, rows []Row, field func(Row) T) (placeholders string, args []any) {
+	if len(rows) == 0 {
+		return "", nil
+	}
+	var b strings.Builder
+	args = make([]any, len(rows))
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(dialect.Placeholder.Nth(i + 1))
+		args[i] = field(row)
+	}
+	return b.String(), args
+}
+
+// PlaceholderRows returns the placeholders of a multi-row VALUES clause with
+// the given number of columns and rows, for example:
+//
+//	(?, ?, ?), (?, ?, ?)
+//	($1, $2, $3), ($4, $5, $6)
+//
+// When batches of rows have the same size, the string can be computed once and
+// reused for every batch instead of being rebuilt each time, only the last
+// batch of a sequence may need placeholders of its own:
+//
+//	const batchSize = 100
+//	placeholders := sqlrange.PlaceholderRows(3, batchSize, sqlrange.Question)
+//	...
+//	sqlrange.ExecQuery(func(query string, rows []RowType) string {
+//	  if len(rows) == batchSize {
+//	    return query + placeholders
+//	  }
+//	  return query + sqlrange.PlaceholderRows(3, len(rows), sqlrange.Question)
+//	}),
+//
+// The result is empty when cols or rows is zero.
+func PlaceholderRows(cols, rows int, style Placeholder) string {
+	if cols <= 0 || rows <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	var buf [20]byte
+	b.Grow(rows*(3*cols+2) - 2)
+	n := 0
+	for i := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j := range cols {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			if n++; style == Dollar {
+				b.WriteByte('$')
+				b.Write(strconv.AppendInt(buf[:0], int64(n), 10))
+			} else {
+				b.WriteByte('?')
+			}
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// Renumber shifts the numbered placeholders ($1, $2, ...) of a query fragment by
+// offset, which is useful to compose queries from fragments using the [Dollar]
+// placeholder style, for example:
+//
+//	query := "SELECT * FROM orders WHERE user_id = $1 AND " +
+//	  sqlrange.Renumber("created_at BETWEEN $1 AND $2", 1)
+//
+// Placeholders appearing in quoted strings and identifiers are left untouched.
+// Note that the function does not recognize dollar-quoted strings, which must
+// not contain text that looks like placeholders.
+func Renumber(fragment string, offset int) string {
+	var b strings.Builder
+	b.Grow(len(fragment))
+
+	for i := 0; i < len(fragment); {
+		switch c := fragment[i]; c {
+		case '\'', '"':
+			j := strings.IndexByte(fragment[i+1:], c)
+			if j < 0 {
+				j = len(fragment)
+			} else {
+				j += i + 2
+			}
+			b.WriteString(fragment[i:j])
+			i = j
+		case '$':
+			j := i + 1
+			for j < len(fragment) && fragment[j] >= '0' && fragment[j] <= '9' {
+				j++
+			}
+			if n, err := strconv.Atoi(fragment[i+1 : j]); err == nil {
+				b.WriteString(Dollar.Nth(n + offset))
+			} else {
+				b.WriteString(fragment[i:j])
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
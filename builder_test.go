@@ -0,0 +1,210 @@
+package sqlrange_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+func TestInValues(t *testing.T) {
+	type user struct {
+		ID   int64  `sql:"id"`
+		Name string `sql:"name"`
+	}
+
+	users := []user{
+		{ID: 1, Name: "Alice"},
+		{ID: 2, Name: "Bob"},
+		{ID: 3, Name: "Chris"},
+	}
+
+	placeholders, args := sqlrange.InValues(sqlrange.MySQL, users, func(u user) int64 { return u.ID })
+
+	if placeholders != "?, ?, ?" {
+		t.Errorf("expect %q, got %q", "?, ?, ?", placeholders)
+	}
+	if expect := []any{int64(1), int64(2), int64(3)}; !slices.Equal(args, expect) {
+		t.Errorf("expect %v, got %v", expect, args)
+	}
+
+	placeholders, args = sqlrange.InValues(sqlrange.Postgres, users, func(u user) string { return u.Name })
+
+	if placeholders != "$1, $2, $3" {
+		t.Errorf("expect %q, got %q", "$1, $2, $3", placeholders)
+	}
+	if expect := []any{"Alice", "Bob", "Chris"}; !slices.Equal(args, expect) {
+		t.Errorf("expect %v, got %v", expect, args)
+	}
+
+	if placeholders, args := sqlrange.InValues(sqlrange.Postgres, []user{}, func(u user) int64 { return u.ID }); placeholders != "" || args != nil {
+		t.Errorf("expect no placeholders and arguments, got %q and %v", placeholders, args)
+	}
+}
+
+type order struct {
+	ID    int64  `sql:"id"`
+	Order int64  `sql:"order"`
+	Item  string `sql:"item"`
+}
+
+func TestInsertQuery(t *testing.T) {
+	tests := []struct {
+		dialect sqlrange.Dialect
+		table   string
+		expect  string
+	}{
+		{sqlrange.Postgres, "orders", `INSERT INTO "orders" ("id", "order", "item") VALUES ($1, $2, $3)`},
+		{sqlrange.MySQL, "orders", "INSERT INTO `orders` (`id`, `order`, `item`) VALUES (?, ?, ?)"},
+		{sqlrange.SQLite, "shop.orders", `INSERT INTO "shop"."orders" ("id", "order", "item") VALUES (?, ?, ?)`},
+		{sqlrange.Dialect{}, "orders", `INSERT INTO orders (id, order, item) VALUES (?, ?, ?)`},
+	}
+
+	for _, test := range tests {
+		if query := sqlrange.InsertQuery[order](test.dialect, test.table); query != test.expect {
+			t.Errorf("expect %s, got %s", test.expect, query)
+		}
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	if s := sqlrange.QuoteDoubleQuotes(`a"b`); s != `"a""b"` {
+		t.Errorf("wrong double-quoted identifier: %s", s)
+	}
+	if s := sqlrange.QuoteBackticks("a`b"); s != "`a``b`" {
+		t.Errorf("wrong backtick-quoted identifier: %s", s)
+	}
+}
+
+func TestPlaceholderRows(t *testing.T) {
+	tests := []struct {
+		cols, rows int
+		style      sqlrange.Placeholder
+		expect     string
+	}{
+		{3, 2, sqlrange.Question, `(?, ?, ?), (?, ?, ?)`},
+		{3, 2, sqlrange.Dollar, `($1, $2, $3), ($4, $5, $6)`},
+		{1, 1, sqlrange.Question, `(?)`},
+		{2, 0, sqlrange.Question, ``},
+		{0, 2, sqlrange.Dollar, ``},
+	}
+
+	for _, test := range tests {
+		if placeholders := sqlrange.PlaceholderRows(test.cols, test.rows, test.style); placeholders != test.expect {
+			t.Errorf("PlaceholderRows(%d, %d, %d): expect %q, got %q", test.cols, test.rows, test.style, test.expect, placeholders)
+		}
+	}
+}
+
+var placeholders string
+
+func BenchmarkPlaceholderRows(b *testing.B) {
+	const cols, rows = 5, 100
+
+	b.Run("each batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			placeholders = sqlrange.PlaceholderRows(cols, rows, sqlrange.Dollar)
+		}
+	})
+
+	b.Run("reused", func(b *testing.B) {
+		b.ReportAllocs()
+		reused := sqlrange.PlaceholderRows(cols, rows, sqlrange.Dollar)
+		for range b.N {
+			placeholders = reused
+		}
+	})
+}
+
+func TestRenumber(t *testing.T) {
+	tests := []struct {
+		fragment string
+		offset   int
+		expect   string
+	}{
+		{"$1,$2", 3, "$4,$5"},
+		{"($1, $2), ($3, $4)", 0, "($1, $2), ($3, $4)"},
+		{"id = $9 OR id = $10", 1, "id = $10 OR id = $11"},
+		{"name = '$1' AND \"$2\" = $3", 2, "name = '$1' AND \"$2\" = $5"},
+		{"price > $ AND tag = 'unterminated $1", 1, "price > $ AND tag = 'unterminated $1"},
+		{"", 1, ""},
+	}
+
+	for _, test := range tests {
+		if fragment := sqlrange.Renumber(test.fragment, test.offset); fragment != test.expect {
+			t.Errorf("Renumber(%q, %d): expect %q, got %q", test.fragment, test.offset, test.expect, fragment)
+		}
+	}
+}
+
+func TestWhereEquals(t *testing.T) {
+	type filter struct {
+		ID     int64  `sql:"id"`
+		Name   string `sql:"name"`
+		Status string `sql:"status"`
+		Age    int    `sql:"age"`
+	}
+
+	where, args := sqlrange.WhereEquals(sqlrange.Postgres, filter{Name: "Alice", Age: 42})
+
+	if expect := `"name" = $1 AND "age" = $2`; where != expect {
+		t.Errorf("expect %q, got %q", expect, where)
+	}
+	if expect := []any{"Alice", 42}; !slices.Equal(args, expect) {
+		t.Errorf("expect %v, got %v", expect, args)
+	}
+
+	where, args = sqlrange.WhereEquals(sqlrange.MySQL, filter{ID: 1, Status: "active"})
+
+	if expect := "`id` = ? AND `status` = ?"; where != expect {
+		t.Errorf("expect %q, got %q", expect, where)
+	}
+	if expect := []any{int64(1), "active"}; !slices.Equal(args, expect) {
+		t.Errorf("expect %v, got %v", expect, args)
+	}
+
+	if where, args := sqlrange.WhereEquals(sqlrange.Postgres, filter{}); where != "" || args != nil {
+		t.Errorf("expect no condition and arguments, got %q and %v", where, args)
+	}
+}
+
+func TestUpdateQuery(t *testing.T) {
+	tests := []struct {
+		dialect sqlrange.Dialect
+		columns []string
+		where   []string
+		expect  string
+	}{
+		{sqlrange.Postgres, []string{"order", "item"}, []string{"id"}, `UPDATE "orders" SET "order" = $1, "item" = $2 WHERE "id" = $3`},
+		{sqlrange.MySQL, []string{"item"}, []string{"id", "order"}, "UPDATE `orders` SET `item` = ? WHERE `id` = ? AND `order` = ?"},
+		{sqlrange.Dialect{}, []string{"item"}, nil, `UPDATE orders SET item = ?`},
+	}
+
+	for _, test := range tests {
+		if query := sqlrange.UpdateQuery(test.dialect, "orders", test.columns, test.where...); query != test.expect {
+			t.Errorf("expect %s, got %s", test.expect, query)
+		}
+	}
+}
+
+func TestUpsertMySQL(t *testing.T) {
+	type user struct {
+		ID   int64  `sql:"id"`
+		Name string `sql:"name"`
+	}
+
+	tests := []struct {
+		update []string
+		expect string
+	}{
+		{[]string{"name"}, "INSERT INTO `users` (`id`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)"},
+		{nil, "INSERT INTO `users` (`id`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `id` = VALUES(`id`), `name` = VALUES(`name`)"},
+	}
+
+	for _, test := range tests {
+		if query := sqlrange.UpsertMySQL[user]("users", test.update...); query != test.expect {
+			t.Errorf("expect %s, got %s", test.expect, query)
+		}
+	}
+}
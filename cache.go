@@ -0,0 +1,205 @@
+package sqlrange
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// QueryCacheSize is the maximum number of results retained by the cache of
+// [QueryCached]. When the cache is full, expired results are removed first,
+// then the results closest to expiring.
+const QueryCacheSize = 1024
+
+// QueryCached is like [QueryContext] but it collects the rows in a slice, and
+// retains them in an in-memory cache for the duration of the ttl, so identical
+// queries executed during that time return the same rows without querying the
+// database, for example:
+//
+//	countries, err := sqlrange.QueryCached[Country](ctx, db,
+//	  `SELECT code, name FROM countries`, time.Minute,
+//	)
+//
+// Queries are identical when they have the same Row type, are executed on the
+// same [Queryable] value, and have the same query string after being rewritten
+// by the context hooks (see [WithQueryRewriter]), and the same arguments. The
+// arguments are compared by their values after the default conversions of
+// database/sql, so pointers and [driver.Valuer] implementations are compared by
+// the values they refer to; the function returns an error if one of them cannot
+// be converted. The scan options passed among the arguments are not part of the
+// comparison, programs must use the same options for identical queries.
+//
+// Errors are not cached. Each call returns a new slice, which the program may
+// modify, but the rows are shallow copies of the cached values: slices, maps,
+// and pointers held by the fields are shared with the cache and must not be
+// modified.
+//
+// The cache is shared by all the goroutines of the program, it is intended for
+// read-heavy workloads tolerating stale results, such as querying reference
+// data. [ClearQueryCache] can be used to invalidate the results before they
+// expire, for example after modifying the tables.
+func QueryCached[Row any](ctx context.Context, q Queryable, query string, ttl time.Duration, args ...any) ([]Row, error) {
+	hooks := hooksFrom(ctx)
+	rows, err := queryCached[Row](ctx, &hooks, q, query, ttl, args)
+	if err != nil {
+		hooks.incErrors()
+	}
+	return rows, err
+}
+
+func queryCached[Row any](ctx context.Context, hooks *hooks, q Queryable, query string, ttl time.Duration, args []any) ([]Row, error) {
+	query, err := hooks.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if !reflect.TypeOf(q).Comparable() {
+		return nil, fmt.Errorf("cannot cache the results of queries executed on values of type %T", q)
+	}
+
+	queryArgs, _ := splitScanOptions(args)
+	keyArgs, err := queryCacheArgs(queryArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	key := queryCacheKey{
+		t:     reflect.TypeOf(new(Row)).Elem(),
+		q:     q,
+		query: query,
+		args:  keyArgs,
+	}
+
+	if rows, ok := queryCache.load(key); ok {
+		return slices.Clone(rows.([]Row)), nil
+	}
+
+	// The errors of the query are counted by QueryCached, the metrics of the
+	// context only count its queries and rows.
+	if hooks.metrics != nil {
+		ctx = WithMetrics(ctx, uncountedErrors{hooks.metrics})
+	}
+	queryHooks := hooksFrom(ctx)
+
+	rows, err := Collect(func(yield func(Row, error) bool) {
+		queryRewritten[Row](ctx, &queryHooks, yield, q, query, args)
+	})
+	if err != nil {
+		return nil, err
+	}
+	queryCache.store(key, rows, ttl)
+	return slices.Clone(rows), nil
+}
+
+// uncountedErrors wraps metrics to ignore the errors, which are counted by the
+// caller instead.
+type uncountedErrors struct{ Metrics }
+
+func (uncountedErrors) IncErrors() {}
+
+// queryCacheArgs returns the representation of query arguments used in the keys
+// of the cache. The arguments are converted to driver values first, so values
+// referenced by pointers are compared instead of their addresses.
+func queryCacheArgs(args []any) (string, error) {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		named, isNamed := arg.(sql.NamedArg)
+		if isNamed {
+			arg = named.Value
+		}
+		v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return "", fmt.Errorf("cannot cache the results of queries with argument %d of type %T: %w", i, arg, err)
+		}
+		if isNamed {
+			named.Value = v
+			v = named
+		}
+		values[i] = v
+	}
+	return fmt.Sprintf("%#v", values), nil
+}
+
+// ClearQueryCache removes all the results retained by [QueryCached].
+func ClearQueryCache() {
+	queryCache.clear()
+}
+
+type queryCacheKey struct {
+	t     reflect.Type
+	q     Queryable
+	query string
+	args  string
+}
+
+type queryCacheEntry struct {
+	rows    any // []Row
+	expires time.Time
+}
+
+type resultCache struct {
+	mutex   sync.Mutex
+	entries map[queryCacheKey]queryCacheEntry
+}
+
+var queryCache resultCache
+
+func (c *resultCache) load(key queryCacheKey) (any, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.rows, true
+}
+
+func (c *resultCache) store(key queryCacheKey, rows any, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[queryCacheKey]queryCacheEntry)
+	}
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= QueryCacheSize {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= QueryCacheSize {
+			var oldest queryCacheKey
+			var expires time.Time
+			for k, e := range c.entries {
+				if expires.IsZero() || e.expires.Before(expires) {
+					oldest, expires = k, e.expires
+				}
+			}
+			delete(c.entries, oldest)
+		}
+	}
+
+	c.entries[key] = queryCacheEntry{rows: rows, expires: now.Add(ttl)}
+}
+
+func (c *resultCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	clear(c.entries)
+}
@@ -0,0 +1,186 @@
+package sqlrange_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+func TestQueryCached(t *testing.T) {
+	defer sqlrange.ClearQueryCache()
+
+	queries := 0
+	db := newStubDB(func(_ string, args []driver.NamedValue) (driver.Rows, error) {
+		queries++
+		return newStubRows([]string{"name", "age"},
+			[]driver.Value{"Alice", args[0].Value},
+		), nil
+	})
+	defer db.Close()
+
+	ctx := context.Background()
+	const query = `SELECT name, age FROM people WHERE age = ?`
+
+	for _, test := range []struct {
+		age     int64
+		ttl     time.Duration
+		queries int
+	}{
+		{age: 1, ttl: time.Minute, queries: 1},
+		{age: 1, ttl: time.Minute, queries: 1}, // cached
+		{age: 2, ttl: time.Minute, queries: 2}, // different arguments
+		{age: 2, ttl: time.Minute, queries: 2}, // cached
+	} {
+		people, err := sqlrange.QueryCached[person](ctx, db, query, test.ttl, test.age)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []person{{Name: "Alice", Age: int(test.age)}}; !slices.Equal(people, expect) {
+			t.Errorf("expect %v, got %v", expect, people)
+		}
+		if queries != test.queries {
+			t.Errorf("expect %d queries, got %d", test.queries, queries)
+		}
+	}
+
+	// Modifying the returned slice must not alter the cached rows.
+	people, _ := sqlrange.QueryCached[person](ctx, db, query, time.Minute, int64(1))
+	people[0].Name = "Bob"
+	people, _ = sqlrange.QueryCached[person](ctx, db, query, time.Minute, int64(1))
+	if people[0].Name != "Alice" {
+		t.Errorf("expect the cached rows to be unchanged, got %v", people)
+	}
+
+	sqlrange.ClearQueryCache()
+	if _, err := sqlrange.QueryCached[person](ctx, db, query, time.Millisecond, int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	if queries != 3 {
+		t.Errorf("expect the query to be executed after clearing the cache, got %d queries", queries)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if _, err := sqlrange.QueryCached[person](ctx, db, query, time.Millisecond, int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	if queries != 4 {
+		t.Errorf("expect the query to be executed after the results expired, got %d queries", queries)
+	}
+}
+
+func TestQueryCachedMetrics(t *testing.T) {
+	defer sqlrange.ClearQueryCache()
+
+	errBroken := errors.New("broken")
+	db := newStubDB(func(query string, _ []driver.NamedValue) (driver.Rows, error) {
+		switch query {
+		case `SELECT broken`:
+			return nil, errBroken
+		case `SELECT invalid`:
+			return newStubRows([]string{"name", "age"}, []driver.Value{"Alice", "not a number"}), nil
+		}
+		return newStubRows([]string{"name", "age"}, []driver.Value{"Alice", int64(1)}), nil
+	})
+	defer db.Close()
+
+	metrics := new(counters)
+	ctx := sqlrange.WithMetrics(context.Background(), metrics)
+
+	for _, test := range []struct {
+		query   string
+		args    []any
+		fail    bool
+		queries int64
+		rows    int64
+		errors  int64
+	}{
+		{query: `SELECT name, age FROM people`, queries: 1, rows: 1},
+		{query: `SELECT name, age FROM people`, queries: 1, rows: 1}, // cached
+		{query: `SELECT broken`, fail: true, queries: 2, rows: 1, errors: 1},
+		{query: `SELECT invalid`, fail: true, queries: 3, rows: 1, errors: 2},
+		{query: `SELECT name, age FROM people`, args: []any{struct{}{}}, fail: true, queries: 3, rows: 1, errors: 3},
+	} {
+		_, err := sqlrange.QueryCached[person](ctx, db, test.query, time.Minute, test.args...)
+		if (err != nil) != test.fail {
+			t.Errorf("%s: unexpected error: %v", test.query, err)
+		}
+		if n := metrics.queries.Load(); n != test.queries {
+			t.Errorf("%s: expect %d queries, got %d", test.query, test.queries, n)
+		}
+		if n := metrics.rows.Load(); n != test.rows {
+			t.Errorf("%s: expect %d rows, got %d", test.query, test.rows, n)
+		}
+		if n := metrics.errors.Load(); n != test.errors {
+			t.Errorf("%s: expect %d errors, got %d", test.query, test.errors, n)
+		}
+	}
+}
+
+func TestQueryCachedKey(t *testing.T) {
+	defer sqlrange.ClearQueryCache()
+
+	queries := map[string]int{}
+	newDB := func(name string) *sql.DB {
+		return newStubDB(func(query string, args []driver.NamedValue) (driver.Rows, error) {
+			queries[name]++
+			return newStubRows([]string{"name", "age"},
+				[]driver.Value{name + " " + query, args[0].Value},
+			), nil
+		})
+	}
+	db1, db2 := newDB("db1"), newDB("db2")
+	defer db1.Close()
+	defer db2.Close()
+
+	ctx := context.Background()
+	const query = `SELECT name, age FROM people WHERE age = ?`
+
+	query1 := func(ctx context.Context, db *sql.DB, args ...any) string {
+		t.Helper()
+		people, err := sqlrange.QueryCached[person](ctx, db, query, time.Minute, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return people[0].Name
+	}
+
+	// Pointers to equal values are the same arguments.
+	age1, age2 := int64(1), int64(1)
+	query1(ctx, db1, &age1)
+	query1(ctx, db1, &age2)
+	if queries["db1"] != 1 {
+		t.Errorf("expect pointers to equal values to hit the cache, got %d queries", queries["db1"])
+	}
+
+	// The same query on another database is not cached.
+	if name := query1(ctx, db2, int64(1)); name != "db2 "+query {
+		t.Errorf("expect the rows of the second database, got %q", name)
+	}
+
+	// Queries rewritten differently are not cached.
+	tenant := func(name string) context.Context {
+		return sqlrange.WithQueryRewriter(ctx, func(_ context.Context, query string) (string, error) {
+			return "/* " + name + " */ " + query, nil
+		})
+	}
+	if name := query1(tenant("a"), db1, int64(1)); name != "db1 /* a */ "+query {
+		t.Errorf("wrong rows for tenant a: %q", name)
+	}
+	if name := query1(tenant("b"), db1, int64(1)); name != "db1 /* b */ "+query {
+		t.Errorf("wrong rows for tenant b: %q", name)
+	}
+	query1(tenant("a"), db1, int64(1))
+	if queries["db1"] != 3 {
+		t.Errorf("expect one query per tenant, got %d queries", queries["db1"])
+	}
+
+	if _, err := sqlrange.QueryCached[person](ctx, db1, query, time.Minute, []int{1}); err == nil {
+		t.Error("expect an error for arguments which are not driver values")
+	}
+}
@@ -0,0 +1,180 @@
+package sqlrange
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// RegisterConverter registers the functions converting values of type T to and
+// from the values exchanged with database drivers.
+//
+// Converters allow domain libraries to support types that do not implement
+// [sql.Scanner] or [driver.Valuer], without modifying the types or sqlrange.
+// For example, a geometry type could be decoded from and encoded to the WKB
+// representation used by PostGIS:
+//
+//	func init() {
+//	  sqlrange.RegisterConverter(
+//	    func(src any) (geom.Point, error) {
+//	      b, ok := src.([]byte)
+//	      if !ok {
+//	        return geom.Point{}, fmt.Errorf("unsupported point value: %T", src)
+//	      }
+//	      return wkb.DecodePoint(b)
+//	    },
+//	    func(p geom.Point) (driver.Value, error) {
+//	      return wkb.EncodePoint(p)
+//	    },
+//	  )
+//	}
+//
+// Struct fields of type T are then scanned by calling the scan function with
+// the values returned by the driver, which may be nil for NULL columns, and
+// passed to the queries executed by [Exec] and [ExecContext] as the result of
+// the value function. As with [sql.Scanner], byte slices are owned by the
+// driver and must be copied if the scan function needs to retain them.
+//
+// Calling RegisterConverter multiple times for the same type replaces the
+// converter.
+func RegisterConverter[T any](scan func(src any) (T, error), value func(T) (driver.Value, error)) {
+	t := reflect.TypeOf(new(T)).Elem()
+
+	convertersMutex.Lock()
+	defer convertersMutex.Unlock()
+
+	cache, _ := converters.Load().(map[reflect.Type]typeConverter)
+	newCache := make(map[reflect.Type]typeConverter, len(cache)+1)
+	for k, v := range cache {
+		newCache[k] = v
+	}
+	newCache[t] = &converter[T]{scan: scan, value: value}
+	converters.Store(newCache)
+}
+
+// RegisterTagConverter is like [RegisterConverter] but the converter only applies
+// to struct fields of type T which have the given option in their "sql" tag.
+//
+// This allows the same type to be represented differently depending on the
+// columns, for example to store monetary values as integer cents:
+//
+//	func init() {
+//	  sqlrange.RegisterTagConverter("cents",
+//	    func(src any) (decimal.Decimal, error) {
+//	      cents, ok := src.(int64)
+//	      if !ok {
+//	        return decimal.Decimal{}, fmt.Errorf("unsupported cents value: %T", src)
+//	      }
+//	      return decimal.New(cents, -2), nil
+//	    },
+//	    func(d decimal.Decimal) (driver.Value, error) {
+//	      return d.Shift(2).IntPart(), nil
+//	    },
+//	  )
+//	}
+//
+//	type Product struct {
+//	  Price decimal.Decimal `sql:"price,cents"`
+//	}
+//
+// Converters registered for a tag option take precedence over the converters
+// registered for the type of the field. Calling RegisterTagConverter multiple
+// times for the same option and type replaces the converter.
+func RegisterTagConverter[T any](option string, scan func(src any) (T, error), value func(T) (driver.Value, error)) {
+	key := tagConverterKey{option: option, typ: reflect.TypeOf(new(T)).Elem()}
+
+	convertersMutex.Lock()
+	defer convertersMutex.Unlock()
+
+	cache, _ := tagConverters.Load().(map[tagConverterKey]typeConverter)
+	newCache := make(map[tagConverterKey]typeConverter, len(cache)+1)
+	for k, v := range cache {
+		newCache[k] = v
+	}
+	newCache[key] = &converter[T]{scan: scan, value: value}
+	tagConverters.Store(newCache)
+}
+
+var (
+	converters      atomic.Value // map[reflect.Type]typeConverter
+	tagConverters   atomic.Value // map[tagConverterKey]typeConverter
+	convertersMutex sync.Mutex
+)
+
+type tagConverterKey struct {
+	option string
+	typ    reflect.Type
+}
+
+// tagConverterOf returns the converter registered for one of the tag options of
+// a struct field, or nil if there are none.
+func tagConverterOf(f field) typeConverter {
+	cache, _ := tagConverters.Load().(map[tagConverterKey]typeConverter)
+	if len(cache) == 0 {
+		return nil
+	}
+	for s := string(f.options); s != ""; {
+		var option string
+		option, s, _ = strings.Cut(s, ",")
+		if c := cache[tagConverterKey{option: option, typ: f.field.Type}]; c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// typeConverter converts the values of struct fields of types registered with
+// RegisterConverter, it is implemented by the generic converter type so the
+// conversions can be done without reflection on the field type.
+type typeConverter interface {
+	// arg returns the query argument for a field.
+	arg(fieldValue reflect.Value) any
+	// dest returns the scan destination for a field.
+	dest(fieldValue reflect.Value) any
+}
+
+// converterOf returns the converter registered for a type, or nil if there are
+// none.
+func converterOf(t reflect.Type) typeConverter {
+	cache, _ := converters.Load().(map[reflect.Type]typeConverter)
+	return cache[t]
+}
+
+type converter[T any] struct {
+	scan  func(any) (T, error)
+	value func(T) (driver.Value, error)
+}
+
+func (c *converter[T]) arg(fieldValue reflect.Value) any {
+	return converterArg[T]{c: c, v: fieldValue.Interface().(T)}
+}
+
+func (c *converter[T]) dest(fieldValue reflect.Value) any {
+	return converterDest[T]{c: c, ptr: fieldValue.Addr().Interface().(*T)}
+}
+
+// converterArg is a [driver.Valuer] adapting the value function of a converter,
+// so the errors it returns are reported by the execution of the query.
+type converterArg[T any] struct {
+	c *converter[T]
+	v T
+}
+
+func (a converterArg[T]) Value() (driver.Value, error) { return a.c.value(a.v) }
+
+// converterDest is a [sql.Scanner] adapting the scan function of a converter.
+type converterDest[T any] struct {
+	c   *converter[T]
+	ptr *T
+}
+
+func (d converterDest[T]) Scan(src any) error {
+	v, err := d.c.scan(src)
+	if err != nil {
+		return err
+	}
+	*d.ptr = v
+	return nil
+}
@@ -0,0 +1,175 @@
+package sqlrange_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+// geoPoint is a type which does not implement sql.Scanner or driver.Valuer,
+// it is converted to and from a simplified WKB representation by a registered
+// converter.
+type geoPoint struct {
+	Lng, Lat float64
+}
+
+func init() {
+	sqlrange.RegisterConverter(
+		func(src any) (geoPoint, error) {
+			b, ok := src.([]byte)
+			if !ok || len(b) != 16 {
+				return geoPoint{}, fmt.Errorf("unsupported point value: %T", src)
+			}
+			return geoPoint{
+				Lng: math.Float64frombits(binary.LittleEndian.Uint64(b[0:])),
+				Lat: math.Float64frombits(binary.LittleEndian.Uint64(b[8:])),
+			}, nil
+		},
+		func(p geoPoint) (driver.Value, error) {
+			b := binary.LittleEndian.AppendUint64(nil, math.Float64bits(p.Lng))
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p.Lat))
+			return b, nil
+		},
+	)
+}
+
+// amount is a decimal type represented by a number of units and an exponent,
+// which is stored as integer cents in columns with the "cents" tag option.
+type amount struct {
+	units int64
+	exp   int
+}
+
+func (a amount) String() string {
+	return strconv.FormatFloat(float64(a.units)*math.Pow10(a.exp), 'f', -a.exp, 64)
+}
+
+func init() {
+	sqlrange.RegisterTagConverter("cents",
+		func(src any) (amount, error) {
+			cents, ok := src.(int64)
+			if !ok {
+				return amount{}, fmt.Errorf("unsupported cents value: %T", src)
+			}
+			return amount{units: cents, exp: -2}, nil
+		},
+		func(a amount) (driver.Value, error) {
+			cents := a.units
+			for exp := a.exp; exp < -2; exp++ {
+				cents /= 10
+			}
+			for exp := a.exp; exp > -2; exp-- {
+				cents *= 10
+			}
+			return cents, nil
+		},
+	)
+}
+
+func TestTagConverter(t *testing.T) {
+	type product struct {
+		Price amount `sql:"price,cents"`
+	}
+
+	var stored []driver.Value
+	db := sql.OpenDB(&stubConnector{
+		query: func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"price"}, []driver.Value{int64(1234)}), nil
+		},
+		exec: func(_ string, args []driver.NamedValue) (driver.Result, error) {
+			stored = append(stored, args[0].Value)
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+
+	var products []product
+	for p, err := range sqlrange.Query[product](db, `SELECT price FROM products`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		products = append(products, p)
+	}
+	if len(products) != 1 || products[0].Price.String() != "12.34" {
+		t.Fatalf("expect a price of 12.34, got %v", products)
+	}
+
+	for _, err := range sqlrange.ExecSlice(context.Background(), db, `INSERT INTO products (price) VALUES (?)`,
+		append(products, product{Price: amount{units: 5, exp: 0}}),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expect := []driver.Value{int64(1234), int64(500)}; !slices.Equal(stored, expect) {
+		t.Errorf("expect %v, got %v", expect, stored)
+	}
+}
+
+func TestConverter(t *testing.T) {
+	type place struct {
+		Name     string   `sql:"name"`
+		Location geoPoint `sql:"location"`
+	}
+
+	var stored [][]driver.Value
+	db := sql.OpenDB(&stubConnector{
+		query: func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"name", "location"}, stored...), nil
+		},
+		exec: func(_ string, args []driver.NamedValue) (driver.Result, error) {
+			values := make([]driver.Value, len(args))
+			for i, arg := range args {
+				values[i] = arg.Value
+			}
+			stored = append(stored, values)
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+
+	places := []place{
+		{Name: "Paris", Location: geoPoint{Lng: 2.3522, Lat: 48.8566}},
+		{Name: "Tokyo", Location: geoPoint{Lng: 139.6917, Lat: 35.6895}},
+	}
+
+	for _, err := range sqlrange.Exec(db, `INSERT INTO places (name, location) VALUES (?, ?)`,
+		func(yield func(place, error) bool) {
+			for _, p := range places {
+				if !yield(p, nil) {
+					return
+				}
+			}
+		},
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, values := range stored {
+		if _, ok := values[1].([]byte); !ok {
+			t.Fatalf("expect the location to be passed as bytes, got %T", values[1])
+		}
+	}
+
+	var results []place
+	for p, err := range sqlrange.Query[place](db, `SELECT name, location FROM places`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, p)
+	}
+
+	if !slices.Equal(results, places) {
+		t.Errorf("expect %v, got %v", places, results)
+	}
+}
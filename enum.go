@@ -0,0 +1,89 @@
+package sqlrange
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// RegisterEnum registers the list of values that are valid for the enum type
+// T.
+//
+// Struct fields of type T (or *T) that have the "enum" tag option are validated
+// when scanning rows, and the scan fails with an error if a column contains a
+// value that was not registered. For example:
+//
+//	type Status string
+//
+//	const (
+//	  Active   Status = "active"
+//	  Inactive Status = "inactive"
+//	)
+//
+//	func init() {
+//	  sqlrange.RegisterEnum(Active, Inactive)
+//	}
+//
+//	type Row struct {
+//	  Status Status `sql:"status,enum"`
+//	}
+//
+// Calling RegisterEnum multiple times for the same type adds values to the
+// list of valid values.
+func RegisterEnum[T ~string](values ...T) {
+	t := reflect.TypeOf(new(T)).Elem()
+
+	enumsMutex.Lock()
+	defer enumsMutex.Unlock()
+
+	cache, _ := enums.Load().(map[reflect.Type][]string)
+	newCache := make(map[reflect.Type][]string, len(cache)+1)
+	for k, v := range cache {
+		newCache[k] = v
+	}
+
+	enumValues := slices.Clip(cache[t])
+	for _, v := range values {
+		if !slices.Contains(enumValues, string(v)) {
+			enumValues = append(enumValues, string(v))
+		}
+	}
+	newCache[t] = enumValues
+	enums.Store(newCache)
+}
+
+var (
+	enums      atomic.Value // map[reflect.Type][]string
+	enumsMutex sync.Mutex
+)
+
+// enumCheck returns a function validating that the value of an enum field is
+// one of the values registered for its type.
+func enumCheck(column string, fieldValue reflect.Value) (func() error, error) {
+	t := fieldValue.Type()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	cache, _ := enums.Load().(map[reflect.Type][]string)
+	enumValues, ok := cache[t]
+	if !ok {
+		return nil, fmt.Errorf("column %q: no enum values registered for type %s", column, t)
+	}
+
+	return func() error {
+		v := fieldValue
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		if s := v.String(); !slices.Contains(enumValues, s) {
+			return fmt.Errorf("column %q: invalid value %q for enum type %s", column, s, t)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,55 @@
+package sqlrange_test
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+type status string
+
+const (
+	active   status = "active"
+	inactive status = "inactive"
+)
+
+func init() {
+	sqlrange.RegisterEnum(active, inactive)
+}
+
+func TestScanEnum(t *testing.T) {
+	type account struct {
+		ID     int64  `sql:"id"`
+		Status status `sql:"status,enum"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"id", "status"},
+			[]driver.Value{int64(1), "active"},
+			[]driver.Value{int64(2), "inactive"},
+			[]driver.Value{int64(3), "deleted"},
+		), nil
+	})
+	defer db.Close()
+
+	var accounts []account
+	var err error
+	for a, err1 := range sqlrange.Query[account](db, `SELECT id, status FROM accounts`) {
+		if err = err1; err != nil {
+			break
+		}
+		accounts = append(accounts, a)
+	}
+
+	if len(accounts) != 2 {
+		t.Errorf("expect 2 valid accounts, got %d", len(accounts))
+	}
+	if err == nil {
+		t.Fatal("expected an error for the invalid enum value")
+	}
+	if !strings.Contains(err.Error(), `"deleted"`) {
+		t.Errorf("error does not mention the invalid value: %v", err)
+	}
+}
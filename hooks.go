@@ -0,0 +1,355 @@
+package sqlrange
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// QueryRewriter is the signature of functions rewriting queries before they are
+// sent to the database, see [WithQueryRewriter].
+type QueryRewriter func(ctx context.Context, query string) (string, error)
+
+// WithQueryRewriter returns a context carrying a function that rewrites the
+// queries sent by [QueryContext] and [ExecContext].
+//
+// The rewriter is applied to every query before it is passed to the database,
+// which allows applications to implement cross-cutting concerns in a single
+// place, for example to route queries to the schema of a tenant:
+//
+//	ctx = sqlrange.WithQueryRewriter(ctx, func(ctx context.Context, query string) (string, error) {
+//	  tenant, ok := tenantFromContext(ctx)
+//	  if !ok {
+//	    return "", errNoTenant
+//	  }
+//	  return strings.ReplaceAll(query, "{schema}.", tenant+"."), nil
+//	})
+//
+// If the rewriter returns an error, the query is aborted and the error is
+// yielded by the sequence.
+//
+// When the context already carries a query rewriter, the new rewriter is
+// applied to the output of the previous one.
+func WithQueryRewriter(ctx context.Context, rewrite QueryRewriter) context.Context {
+	h := hooksFrom(ctx)
+	if prev := h.rewriteQuery; prev != nil {
+		next := rewrite
+		rewrite = func(ctx context.Context, query string) (string, error) {
+			query, err := prev(ctx, query)
+			if err != nil {
+				return "", err
+			}
+			return next(ctx, query)
+		}
+	}
+	h.rewriteQuery = rewrite
+	return context.WithValue(ctx, hooksKey{}, &h)
+}
+
+// ArgsValidator is the signature of functions validating the arguments of
+// queries before they are sent to the database, see [WithArgsValidator].
+type ArgsValidator func(query string, args []any) error
+
+// WithArgsValidator returns a context carrying a function that validates the
+// arguments of the queries sent by [QueryContext] and [ExecContext].
+//
+// The validator is called with the query, after it was rewritten by the
+// [QueryRewriter] installed on the context if any, and the arguments that are
+// about to be passed to the database. This allows applications to centralize
+// input validation as a defense-in-depth measure, for example to enforce length
+// limits on strings:
+//
+//	ctx = sqlrange.WithArgsValidator(ctx, func(query string, args []any) error {
+//	  for _, arg := range args {
+//	    if s, ok := arg.(string); ok && len(s) > maxLength {
+//	      return errTooLong
+//	    }
+//	  }
+//	  return nil
+//	})
+//
+// If the validator returns an error, the query is aborted and the error is
+// yielded by the sequence.
+//
+// When the context already carries an arguments validator, both validators are
+// applied, starting with the previous one.
+func WithArgsValidator(ctx context.Context, validate ArgsValidator) context.Context {
+	h := hooksFrom(ctx)
+	if prev := h.validateArgs; prev != nil {
+		next := validate
+		validate = func(query string, args []any) error {
+			if err := prev(query, args); err != nil {
+				return err
+			}
+			return next(query, args)
+		}
+	}
+	h.validateArgs = validate
+	return context.WithValue(ctx, hooksKey{}, &h)
+}
+
+// FieldResolver is the signature of functions resolving the columns that the
+// fields of struct types are mapped to, see [WithFieldResolver].
+type FieldResolver func(reflect.Type) iter.Seq2[string, reflect.StructField]
+
+// WithFieldResolver returns a context carrying a function that replaces the
+// default mapping of columns to struct fields defined by [Fields], for the rows
+// scanned by [QueryContext] and [ScanContext], and the query arguments generated
+// by default by [ExecContext].
+//
+// This is the most flexible extension point of the package, which allows
+// programs to resolve columns from other sources than the "sql" struct tags, for
+// example from the "json" tags:
+//
+//	ctx = sqlrange.WithFieldResolver(ctx, func(t reflect.Type) iter.Seq2[string, reflect.StructField] {
+//	  return func(yield func(string, reflect.StructField) bool) {
+//	    for _, f := range reflect.VisibleFields(t) {
+//	      if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+//	        if !yield(name, f) {
+//	          return
+//	        }
+//	      }
+//	    }
+//	  }
+//	})
+//
+// The resolver is called each time a query is executed, programs should cache
+// the results if resolving the fields is expensive. Note that the options of
+// "sql" tags, including "extra" and "jsonpath", do not apply when a resolver is
+// installed, and that the options constructing the arguments of queries from
+// column names, such as [ExecArgsFields], still use the default mapping.
+func WithFieldResolver(ctx context.Context, resolve FieldResolver) context.Context {
+	h := hooksFrom(ctx)
+	h.resolveFields = resolve
+	return context.WithValue(ctx, hooksKey{}, &h)
+}
+
+// WithTags returns a context carrying the list of struct tag keys looked up to
+// map columns to struct fields, in order of precedence, which is useful when
+// migrating struct types from the tags of another library:
+//
+//	ctx = sqlrange.WithTags(ctx, "sql", "db")
+//
+// The value and options of the first tag present on each field are used, so in
+// the example above, fields tagged only with "db" are mapped to columns, and the
+// "sql" tag takes precedence on fields which have both. The default is to only
+// look up the "sql" tag.
+//
+// The tags apply where the mapping of columns to fields is affected by
+// [WithFieldResolver], which takes precedence when both are installed on the
+// context.
+func WithTags(ctx context.Context, tags ...string) context.Context {
+	h := hooksFrom(ctx)
+	h.tags = slices.Clone(tags)
+	return context.WithValue(ctx, hooksKey{}, &h)
+}
+
+// Metrics is the interface of counters incremented by the package to monitor
+// the queries, see [WithMetrics].
+//
+// The methods may be called concurrently from multiple goroutines.
+type Metrics interface {
+	// IncQueries is called each time a query is sent to the database.
+	IncQueries()
+	// IncRows is called each time a row is scanned from the results of a
+	// query.
+	IncRows()
+	// IncErrors is called each time a sequence yields an error.
+	IncErrors()
+}
+
+// WithMetrics returns a context carrying the metrics incremented by
+// [QueryContext], [ScanContext], [ExecContext], and the functions built on them,
+// as well as [QueryScalar] and [QueryMap], for example to export them to a
+// monitoring system:
+//
+//	ctx = sqlrange.WithMetrics(ctx, metrics)
+//	for row, err := range sqlrange.QueryContext[Row](ctx, db, query) {
+//	  ...
+//	}
+//
+// When no metrics are installed on the context, the functions do not incur any
+// overhead to maintain them.
+//
+// When the context already carries metrics, they are replaced.
+func WithMetrics(ctx context.Context, metrics Metrics) context.Context {
+	h := hooksFrom(ctx)
+	h.metrics = metrics
+	return context.WithValue(ctx, hooksKey{}, &h)
+}
+
+// Timer is the interface of observers receiving the time spent in calls to the
+// database, see [WithTimer].
+//
+// The methods may be called concurrently from multiple goroutines.
+type Timer interface {
+	// ObserveQuery is called after each call to the QueryContext or
+	// ExecContext method of a [Queryable] or [Executable], with the query, the
+	// time the call took, and the error it returned if any.
+	ObserveQuery(query string, d time.Duration, err error)
+	// ObserveConn is called after each connection acquired by [Conn], with the
+	// time spent waiting for the connection, and the error returned if any.
+	ObserveConn(d time.Duration, err error)
+}
+
+// WithTimer returns a context carrying a timer which observes the duration of
+// the calls made to the database by [QueryContext], [ExecContext], and the
+// functions built on them, which is useful to diagnose slow queries or the
+// exhaustion of connection pools:
+//
+//	ctx = sqlrange.WithTimer(ctx, timer)
+//
+// The durations cover the calls to the QueryContext and ExecContext methods,
+// which for queries returning rows ends when the first results are available,
+// not when all the rows were read. When called on a [sql.DB], the durations
+// include the time spent waiting for a connection from the pool, which the
+// database/sql package does not report separately. Programs that need to
+// distinguish the two can acquire connections with [Conn], which reports the
+// acquisition time, and run the queries on the connection:
+//
+//	conn, err := sqlrange.Conn(ctx, db)
+//	if err != nil {
+//	  ...
+//	}
+//	defer conn.Close()
+//	for row, err := range sqlrange.QueryContext[Row](ctx, conn, query) {
+//	  ...
+//	}
+//
+// When no timer is installed on the context, the functions do not read the
+// clock. When the context already carries a timer, it is replaced.
+func WithTimer(ctx context.Context, timer Timer) context.Context {
+	h := hooksFrom(ctx)
+	h.timer = timer
+	return context.WithValue(ctx, hooksKey{}, &h)
+}
+
+// Conn acquires a connection from db, reporting the time spent waiting for it
+// to the [Timer] installed on the context, if any. The program must close the
+// connection to return it to the pool.
+func Conn(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	h := hooksFrom(ctx)
+	start := h.start()
+	conn, err := db.Conn(ctx)
+	if h.timer != nil {
+		h.timer.ObserveConn(time.Since(start), err)
+	}
+	return conn, err
+}
+
+type hooksKey struct{}
+
+// hooks is the set of functions installed on a context to intercept the
+// operations of the package.
+type hooks struct {
+	rewriteQuery  QueryRewriter
+	validateArgs  ArgsValidator
+	resolveFields FieldResolver
+	tags          []string
+	metrics       Metrics
+	timer         Timer
+}
+
+// hooksFrom returns a copy of the hooks installed on the context.
+func hooksFrom(ctx context.Context) hooks {
+	if h, _ := ctx.Value(hooksKey{}).(*hooks); h != nil {
+		return *h
+	}
+	return hooks{}
+}
+
+func (h *hooks) query(ctx context.Context, query string) (string, error) {
+	if h.rewriteQuery != nil {
+		return h.rewriteQuery(ctx, query)
+	}
+	return query, nil
+}
+
+// tagKeys returns the struct tag keys installed on the context, or the default
+// "sql" tag if there are none.
+func (h *hooks) tagKeys() []string {
+	if h.tags != nil {
+		return h.tags
+	}
+	return defaultTags
+}
+
+// fields returns the fields of a struct type, as defined by the resolver or the
+// tags installed on the context, or by [Fields] if there are none.
+func (h *hooks) fields(t reflect.Type) []field {
+	if h.resolveFields == nil {
+		if h.tags != nil {
+			return cachedFieldsOfTags(t, h.tags)
+		}
+		return cachedFieldsOf(t)
+	}
+	var fields []field
+	for name, f := range h.resolveFields(t) {
+		fields = append(fields, field{name: name, field: f})
+	}
+	return fields
+}
+
+func (h *hooks) validate(query string, args []any) error {
+	if h.validateArgs != nil {
+		return h.validateArgs(query, args)
+	}
+	return nil
+}
+
+// start returns the time at which a call to the database starts, or the zero
+// time when no timer is installed.
+func (h *hooks) start() time.Time {
+	if h.timer != nil {
+		return time.Now()
+	}
+	return time.Time{}
+}
+
+// observe reports the duration of a call to the database which started at the
+// time returned by start.
+func (h *hooks) observe(query string, start time.Time, err error) {
+	if h.timer != nil {
+		h.timer.ObserveQuery(query, time.Since(start), err)
+	}
+}
+
+func (h *hooks) incQueries() {
+	if h.metrics != nil {
+		h.metrics.IncQueries()
+	}
+}
+
+func (h *hooks) incRows() {
+	if h.metrics != nil {
+		h.metrics.IncRows()
+	}
+}
+
+func (h *hooks) incErrors() {
+	if h.metrics != nil {
+		h.metrics.IncErrors()
+	}
+}
+
+// countYield wraps a yield function to increment the metrics for each error,
+// and for each row when rows is true.
+//
+// The function returns yield unchanged when no metrics are installed.
+func countYield[T any](h *hooks, yield func(T, error) bool, rows bool) func(T, error) bool {
+	m := h.metrics
+	if m == nil {
+		return yield
+	}
+	return func(v T, err error) bool {
+		if err != nil {
+			m.IncErrors()
+		} else if rows {
+			m.IncRows()
+		}
+		return yield(v, err)
+	}
+}
@@ -0,0 +1,436 @@
+package sqlrange_test
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+func TestQueryRewriter(t *testing.T) {
+	db := newTestDB(t, "")
+	defer db.Close()
+	exec(t, db, "CREATE|tenant1.people|name=string,age=int32")
+
+	ctx := sqlrange.WithQueryRewriter(context.Background(),
+		func(ctx context.Context, query string) (string, error) {
+			return strings.Replace(query, "|people|", "|tenant1.people|", 1), nil
+		},
+	)
+
+	for _, err := range sqlrange.ExecContext(ctx, db, `INSERT|people|name=?,age=?`,
+		func(yield func(person, error) bool) {
+			_ = yield(person{Age: 19, Name: "Luke"}, nil) &&
+				yield(person{Age: 42, Name: "Hitchhiker"}, nil)
+		},
+		sqlrange.ExecArgsFields[person]("name", "age"),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var people []person
+	for p, err := range sqlrange.QueryContext[person](ctx, db, `SELECT|people|age,name|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		people = append(people, p)
+	}
+
+	expect := []person{
+		{Age: 19, Name: "Luke"},
+		{Age: 42, Name: "Hitchhiker"},
+	}
+
+	if !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+}
+
+func TestQueryRewriterError(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	errNoTenant := errors.New("no tenant")
+	ctx := sqlrange.WithQueryRewriter(context.Background(),
+		func(ctx context.Context, query string) (string, error) {
+			return "", errNoTenant
+		},
+	)
+
+	for _, err := range sqlrange.QueryContext[person](ctx, db, `SELECT|people|age,name|`) {
+		if !errors.Is(err, errNoTenant) {
+			t.Errorf("expect query error %v, got %v", errNoTenant, err)
+		}
+	}
+
+	n := 0
+	for _, err := range sqlrange.ExecContext(ctx, db, `INSERT|people|name=?,age=?`,
+		func(yield func(person, error) bool) {
+			_ = yield(person{Age: 19, Name: "Luke"}, nil)
+		},
+		sqlrange.ExecArgsFields[person]("name", "age"),
+	) {
+		if n++; !errors.Is(err, errNoTenant) {
+			t.Errorf("expect exec error %v, got %v", errNoTenant, err)
+		}
+	}
+	if n != 1 {
+		t.Errorf("expect 1 result, got %d", n)
+	}
+
+	for p, err := range sqlrange.Query[person](db, `SELECT|people|age,name|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name == "Luke" {
+			t.Error("the aborted insert was executed")
+		}
+	}
+}
+
+type counters struct {
+	queries, rows, errors atomic.Int64
+}
+
+func (c *counters) IncQueries() { c.queries.Add(1) }
+func (c *counters) IncRows()    { c.rows.Add(1) }
+func (c *counters) IncErrors()  { c.errors.Add(1) }
+
+func TestMetrics(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	metrics := new(counters)
+	ctx := sqlrange.WithMetrics(context.Background(), metrics)
+
+	for _, err := range sqlrange.ExecContext(ctx, db, `INSERT|people|name=?,age=?`,
+		func(yield func(person, error) bool) {
+			_ = yield(person{Age: 19, Name: "Luke"}, nil) &&
+				yield(person{Age: 42, Name: "Hitchhiker"}, nil)
+		},
+		sqlrange.ExecArgsFields[person]("name", "age"),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, err := range sqlrange.QueryContext[person](ctx, db, `SELECT|people|age,name|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, err := range sqlrange.QueryContext[person](ctx, db, `SELECT|nobody|age,name|`) {
+		if err == nil {
+			t.Error("expect an error querying a table which does not exist")
+		}
+	}
+
+	if n := metrics.queries.Load(); n != 4 {
+		t.Errorf("expect 4 queries, got %d", n)
+	}
+	if n := metrics.rows.Load(); n != 5 {
+		t.Errorf("expect 5 rows, got %d", n)
+	}
+	if n := metrics.errors.Load(); n != 1 {
+		t.Errorf("expect 1 error, got %d", n)
+	}
+}
+
+type timings struct {
+	mutex   sync.Mutex
+	queries []string
+	errors  int
+	conns   int
+}
+
+func (t *timings) ObserveQuery(query string, d time.Duration, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if d < 0 {
+		panic("negative duration")
+	}
+	t.queries = append(t.queries, query)
+	if err != nil {
+		t.errors++
+	}
+}
+
+func (t *timings) ObserveConn(d time.Duration, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if d < 0 || err != nil {
+		panic("invalid connection timing")
+	}
+	t.conns++
+}
+
+func TestTimer(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	timer := new(timings)
+	ctx := sqlrange.WithTimer(context.Background(), timer)
+
+	conn, err := sqlrange.Conn(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Raw(func(dc any) error {
+		dc.(*fakeConn).skipDirtySession = true
+		return nil
+	})
+
+	for _, err := range sqlrange.ExecContext(ctx, conn, `INSERT|people|name=?,age=?`,
+		func(yield func(person, error) bool) {
+			_ = yield(person{Age: 19, Name: "Luke"}, nil) &&
+				yield(person{Age: 42, Name: "Hitchhiker"}, nil)
+		},
+		sqlrange.ExecArgsFields[person]("name", "age"),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, err := range sqlrange.QueryContext[person](ctx, conn, `SELECT|people|age,name|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, err := range sqlrange.QueryContext[person](ctx, db, `SELECT|nobody|age,name|`) {
+		if err == nil {
+			t.Error("expect an error querying a table which does not exist")
+		}
+	}
+
+	expect := []string{
+		`INSERT|people|name=?,age=?`,
+		`INSERT|people|name=?,age=?`,
+		`SELECT|people|age,name|`,
+		`SELECT|nobody|age,name|`,
+	}
+	if !slices.Equal(timer.queries, expect) {
+		t.Errorf("expect %q, got %q", expect, timer.queries)
+	}
+	if timer.errors != 1 {
+		t.Errorf("expect 1 error, got %d", timer.errors)
+	}
+	if timer.conns != 1 {
+		t.Errorf("expect 1 connection, got %d", timer.conns)
+	}
+}
+
+func TestArgsValidator(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	errTooLong := errors.New("argument too long")
+	ctx := sqlrange.WithArgsValidator(context.Background(),
+		func(query string, args []any) error {
+			for _, arg := range args {
+				if s, ok := arg.(string); ok && len(s) > 8 {
+					return errTooLong
+				}
+			}
+			return nil
+		},
+	)
+
+	n := 0
+	for _, err := range sqlrange.ExecContext(ctx, db, `INSERT|people|name=?,age=?`,
+		func(yield func(person, error) bool) {
+			_ = yield(person{Age: 19, Name: "Luke"}, nil) &&
+				yield(person{Age: 42, Name: "Hitchhiker"}, nil) &&
+				yield(person{Age: 7, Name: "Leia"}, nil)
+		},
+		sqlrange.ExecArgsFields[person]("name", "age"),
+	) {
+		n++
+		if n == 2 && !errors.Is(err, errTooLong) {
+			t.Errorf("expect exec error %v, got %v", errTooLong, err)
+		}
+	}
+	if n != 2 {
+		t.Errorf("expect 2 results, got %d", n)
+	}
+
+	for _, err := range sqlrange.QueryContext[person](ctx, db, `SELECT|people|age,name|name=?`, "Hitchhiker") {
+		if !errors.Is(err, errTooLong) {
+			t.Errorf("expect query error %v, got %v", errTooLong, err)
+		}
+	}
+
+	var names []string
+	for p, err := range sqlrange.QueryContext[person](ctx, db, `SELECT|people|age,name|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, p.Name)
+	}
+	if slices.Contains(names, "Hitchhiker") || slices.Contains(names, "Leia") {
+		t.Errorf("the aborted inserts were executed: %v", names)
+	}
+	if !slices.Contains(names, "Luke") {
+		t.Errorf("the valid insert was not executed: %v", names)
+	}
+}
+
+func TestFieldResolver(t *testing.T) {
+	type user struct {
+		Age  int    `json:"age"`
+		Name string `json:"name,omitempty"`
+		Skip string `json:"-"`
+	}
+
+	ctx := sqlrange.WithFieldResolver(context.Background(),
+		func(t reflect.Type) iter.Seq2[string, reflect.StructField] {
+			return func(yield func(string, reflect.StructField) bool) {
+				for _, f := range reflect.VisibleFields(t) {
+					if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+						if !yield(name, f) {
+							return
+						}
+					}
+				}
+			}
+		},
+	)
+
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	for _, err := range sqlrange.ExecContext(ctx, db, `INSERT|people|age=?,name=?`,
+		func(yield func(user, error) bool) {
+			yield(user{Age: 42, Name: "Hitchhiker", Skip: "ignored"}, nil)
+		},
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var users []user
+	for u, err := range sqlrange.QueryContext[user](ctx, db, `SELECT|people|age,name|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+
+	expect := []user{
+		{Age: 1, Name: "Alice"},
+		{Age: 2, Name: "Bob"},
+		{Age: 3, Name: "Chris"},
+		{Age: 42, Name: "Hitchhiker"},
+	}
+	if !slices.Equal(users, expect) {
+		t.Errorf("expect %v, got %v", expect, users)
+	}
+}
+
+func TestFieldResolverTagOptions(t *testing.T) {
+	type user struct {
+		Age  int    `json:"age" sql:"doc,jsonpath=$.age"`
+		Name string `json:"name" sql:",extra"`
+	}
+
+	ctx := sqlrange.WithFieldResolver(context.Background(),
+		func(t reflect.Type) iter.Seq2[string, reflect.StructField] {
+			return func(yield func(string, reflect.StructField) bool) {
+				for _, f := range reflect.VisibleFields(t) {
+					if !yield(f.Tag.Get("json"), f) {
+						return
+					}
+				}
+			}
+		},
+	)
+
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	var users []user
+	for u, err := range sqlrange.QueryContext[user](ctx, db, `SELECT|people|age,name|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+
+	expect := []user{
+		{Age: 1, Name: "Alice"},
+		{Age: 2, Name: "Bob"},
+		{Age: 3, Name: "Chris"},
+	}
+	if !slices.Equal(users, expect) {
+		t.Errorf("expect %v, got %v", expect, users)
+	}
+}
+
+func TestTags(t *testing.T) {
+	type user struct {
+		Name  string `sql:"name"`
+		Age   int    `db:"age"`
+		Photo string `sql:"photo" db:"name"`
+		Dead  bool
+	}
+
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	var users []user
+	for u, err := range sqlrange.Query[user](db, `SELECT|people|name,photo|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+		break
+	}
+	if expect := []user{{Name: "Alice", Photo: "APHOTO"}}; !slices.Equal(users, expect) {
+		t.Errorf("expect %v, got %v", expect, users)
+	}
+
+	ctx := sqlrange.WithTags(context.Background(), "sql", "db")
+
+	users = nil
+	for u, err := range sqlrange.QueryContext[user](ctx, db, `SELECT|people|name,age,photo|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+		break
+	}
+	if expect := []user{{Name: "Alice", Age: 1, Photo: "APHOTO"}}; !slices.Equal(users, expect) {
+		t.Errorf("expect %v, got %v", expect, users)
+	}
+
+	// The order of the tags defines their precedence, and the mapping of the
+	// previous query must not be reused from the cache.
+	ctx = sqlrange.WithTags(context.Background(), "db", "sql")
+
+	users = nil
+	for u, err := range sqlrange.QueryContext[user](ctx, db, `SELECT|people|name,age|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+		break
+	}
+	if expect := []user{{Age: 1, Photo: "Alice"}}; !slices.Equal(users, expect) {
+		t.Errorf("expect %v, got %v", expect, users)
+	}
+}
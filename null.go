@@ -0,0 +1,119 @@
+package sqlrange
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// NullTime represents a time.Time that may be NULL. It implements the
+// [sql.Scanner] and [driver.Valuer] interfaces, so it can be used as field of
+// the Row types passed to [Query] and [Exec]:
+//
+//	type Row struct {
+//	  DeletedAt sqlrange.NullTime `sql:"deleted_at"`
+//	}
+//
+// Unlike [sql.NullTime], text values are accepted and parsed with the layout
+// set by [SetDefaultTimeLayout], or [time.RFC3339Nano] if none was set, in the
+// location set by [SetDefaultTimeLocation], or UTC if none was set. Times
+// returned by the driver are converted to that location when one was set.
+type NullTime struct {
+	Time  time.Time
+	Valid bool // Valid is true if Time is not NULL
+}
+
+// Scan satisfies the [sql.Scanner] interface.
+func (n *NullTime) Scan(src any) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*n = NullTime{}
+		return nil
+	case time.Time:
+		n.Time = v
+		if loc := defaultTimeLocation.Load(); loc != nil {
+			n.Time = v.In(loc)
+		}
+	case string:
+		n.Time, err = parseDefaultTime(v)
+	case []byte:
+		n.Time, err = parseDefaultTime(string(v))
+	default:
+		return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type sqlrange.NullTime", src)
+	}
+	n.Valid = err == nil
+	return err
+}
+
+// Value satisfies the [driver.Valuer] interface.
+func (n NullTime) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Time, nil
+}
+
+// parseDefaultTime parses s with the default layout and location of the
+// package.
+func parseDefaultTime(s string) (time.Time, error) {
+	layout := time.RFC3339Nano
+	if l := defaultTimeLayout.Load(); l != nil && *l != "" {
+		layout = *l
+	}
+	loc := defaultTimeLocation.Load()
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.ParseInLocation(layout, s, loc)
+}
+
+// NullJSON represents a json document decoded into a value of type T, which
+// may be NULL. It implements the [sql.Scanner] and [driver.Valuer] interfaces,
+// so it can be used as field of the Row types passed to [Query] and [Exec]:
+//
+//	type Row struct {
+//	  Settings sqlrange.NullJSON[Settings] `sql:"settings"`
+//	}
+//
+// The json null value is distinct from SQL NULL: it is decoded into the zero
+// value of T with Valid set to true.
+type NullJSON[T any] struct {
+	V     T
+	Valid bool // Valid is true if V is not NULL
+}
+
+// Scan satisfies the [sql.Scanner] interface.
+func (n *NullJSON[T]) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*n = NullJSON[T]{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type %T", src, n)
+	}
+	// Decode into a zero value so that fields from the previous row do not
+	// leak into the current one when the document omits them.
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		*n = NullJSON[T]{}
+		return err
+	}
+	*n = NullJSON[T]{V: v, Valid: true}
+	return nil
+}
+
+// Value satisfies the [driver.Valuer] interface, the value is encoded as a
+// json document, or NULL if Valid is false.
+func (n NullJSON[T]) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return json.Marshal(n.V)
+}
@@ -0,0 +1,124 @@
+package sqlrange_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+type settings struct {
+	Theme string   `json:"theme"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type account struct {
+	ID        int64                             `sql:"id"`
+	DeletedAt sqlrange.NullTime                 `sql:"deleted_at"`
+	Settings  sqlrange.NullJSON[settings]       `sql:"settings"`
+	Extra     sqlrange.NullJSON[map[string]int] `sql:"extra"`
+}
+
+func TestNullTypes(t *testing.T) {
+	var rows [][]driver.Value
+	db := sql.OpenDB(&stubConnector{
+		query: func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"id", "deleted_at", "settings", "extra"}, rows...), nil
+		},
+		exec: func(_ string, args []driver.NamedValue) (driver.Result, error) {
+			values := make([]driver.Value, len(args))
+			for i, arg := range args {
+				values[i] = arg.Value
+			}
+			rows = append(rows, values)
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+
+	deletedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	accounts := []account{
+		{ID: 1},
+		{
+			ID:        2,
+			DeletedAt: sqlrange.NullTime{Time: deletedAt, Valid: true},
+			Settings:  sqlrange.NullJSON[settings]{V: settings{Theme: "dark", Tags: []string{"a", "b"}}, Valid: true},
+			Extra:     sqlrange.NullJSON[map[string]int]{V: map[string]int{"x": 1}, Valid: true},
+		},
+		{
+			ID:       3,
+			Settings: sqlrange.NullJSON[settings]{V: settings{Theme: "light"}, Valid: true},
+		},
+	}
+
+	for _, err := range sqlrange.Exec(db, `INSERT INTO accounts (id, deleted_at, settings, extra) VALUES (?, ?, ?, ?)`,
+		sqlrange.Seq2FromSeq(slices.Values(accounts)),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rows[0][1] != nil || rows[0][2] != nil || rows[0][3] != nil {
+		t.Errorf("expect NULL values for invalid fields, got %v", rows[0])
+	}
+	if s, _ := rows[1][2].([]byte); string(s) != `{"theme":"dark","tags":["a","b"]}` {
+		t.Errorf("wrong json document: %q", rows[1][2])
+	}
+
+	got, err := sqlrange.Collect(sqlrange.Query[account](db, `SELECT * FROM accounts`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, accounts) {
+		t.Errorf("expect %+v, got %+v", accounts, got)
+	}
+}
+
+func TestNullTimeText(t *testing.T) {
+	var n sqlrange.NullTime
+	if err := n.Scan("2024-01-02T03:04:05Z"); err != nil {
+		t.Fatal(err)
+	}
+	if expect := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !n.Valid || !n.Time.Equal(expect) {
+		t.Errorf("expect %v, got %+v", expect, n)
+	}
+
+	defer sqlrange.SetDefaultTimeLayout("")
+	sqlrange.SetDefaultTimeLayout(time.DateTime)
+
+	if err := n.Scan([]byte("2024-01-02 03:04:05")); err != nil {
+		t.Fatal(err)
+	}
+	if expect := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !n.Valid || !n.Time.Equal(expect) {
+		t.Errorf("expect %v, got %+v", expect, n)
+	}
+
+	if err := n.Scan("not a time"); err == nil {
+		t.Error("expect an error for an invalid time")
+	}
+	if n.Valid {
+		t.Error("expect an invalid time after a parse error")
+	}
+
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Errorf("expect a NULL time, got %+v (%v)", n, err)
+	}
+}
+
+func TestNullJSONInvalid(t *testing.T) {
+	var n sqlrange.NullJSON[settings]
+	if err := n.Scan(`{"theme":`); err == nil {
+		t.Error("expect an error for an invalid json document")
+	}
+	if err := n.Scan(42); err == nil {
+		t.Error("expect an error for an unsupported value type")
+	}
+	if err := n.Scan(`null`); err != nil || !n.Valid || n.V.Theme != "" {
+		t.Errorf("expect a valid zero value for a json null, got %+v (%v)", n, err)
+	}
+}
@@ -0,0 +1,48 @@
+//go:build pgx
+
+package pgxrange_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/achille-roussel/sqlrange/pgxrange"
+	"github.com/jackc/pgx/v5"
+)
+
+// The example requires a Postgres server, it runs when the tests are built
+// with the pgx tag and DATABASE_URL points to the server:
+//
+//	DATABASE_URL=postgres://localhost:5432/postgres go test -tags pgx ./...
+func ExampleScan() {
+	type Row struct {
+		Age  int    `sql:"age"`
+		Name string `sql:"name"`
+	}
+
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	rows, err := conn.Query(ctx, `SELECT * FROM (VALUES (19, 'Luke'), (42, 'Hitchhiker')) AS people (age, name)`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for row, err := range pgxrange.Scan[Row](rows) {
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(row.Age, row.Name)
+	}
+
+	// Output:
+	// 19 Luke
+	// 42 Hitchhiker
+}
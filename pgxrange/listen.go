@@ -0,0 +1,78 @@
+package pgxrange
+
+import (
+	"context"
+	"iter"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Listener is the interface of connections supporting the notifications of
+// Postgres, it is implemented by *pgx.Conn.
+type Listener interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+}
+
+// Listen returns a sequence of rows produced by executing a query each time a
+// notification is received on a channel, for example to consume the rows of a
+// table as they are inserted:
+//
+//	for event, err := range pgxrange.Listen[Event](ctx, conn, "events",
+//	  `DELETE FROM events RETURNING *`,
+//	) {
+//	  if err != nil {
+//	    ...
+//	  }
+//	  ...
+//	}
+//
+// The connection starts listening on the channel when the iteration begins,
+// and stops when it ends. Notifications sent before are not observed, programs
+// typically run the query once before calling Listen to consume the rows that
+// already exist. Since Postgres may coalesce notifications, the query should
+// return all the new rows rather than the rows designated by the payload of a
+// single notification.
+//
+// The sequence blocks until a notification is received, and ends without error
+// when the context is canceled. The connection is dedicated to the iteration
+// while it is in progress, and cannot be used concurrently.
+func Listen[Row any](ctx context.Context, conn Listener, channel, query string, args ...any) iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		var zero Row
+		listen := "LISTEN " + pgx.Identifier{channel}.Sanitize()
+
+		if _, err := conn.Exec(ctx, listen); err != nil {
+			yield(zero, err)
+			return
+		}
+		defer func() {
+			// The context may be canceled already, the error is ignored
+			// because it only means that the connection was closed, which
+			// also stops listening on the channel.
+			_, _ = conn.Exec(context.WithoutCancel(ctx), "UN"+listen)
+		}()
+
+		for {
+			if _, err := conn.WaitForNotification(ctx); err != nil {
+				if ctx.Err() == nil {
+					yield(zero, err)
+				}
+				return
+			}
+
+			rows, err := conn.Query(ctx, query, args...)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for row, err := range Scan[Row](rows) {
+				if !yield(row, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package pgxrange_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/achille-roussel/sqlrange/pgxrange"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// stubListener is a pgxrange.Listener delivering a fixed list of
+// notifications, then blocking until the context is canceled.
+type stubListener struct {
+	notifications []*pgconn.Notification
+	batches       [][][]any
+	execs         []string
+	queries       int
+}
+
+func (l *stubListener) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	l.execs = append(l.execs, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (l *stubListener) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rows := &stubRows{columns: []string{"name", "age"}, values: l.batches[l.queries]}
+	l.queries++
+	return rows, nil
+}
+
+func (l *stubListener) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	if len(l.notifications) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	n := l.notifications[0]
+	l.notifications = l.notifications[1:]
+	return n, nil
+}
+
+func TestListen(t *testing.T) {
+	conn := &stubListener{
+		notifications: []*pgconn.Notification{
+			{Channel: "people"},
+			{Channel: "people"},
+		},
+		batches: [][][]any{
+			{{"Alice", 1}},
+			{{"Bob", 2}, {"Chris", 3}},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var people []person
+	for p, err := range pgxrange.Listen[person](ctx, conn, "people", `DELETE FROM people RETURNING name, age`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if people = append(people, p); len(people) == 3 {
+			cancel()
+		}
+	}
+
+	expect := []person{
+		{Name: "Alice", Age: 1},
+		{Name: "Bob", Age: 2},
+		{Name: "Chris", Age: 3},
+	}
+	if !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+
+	if expect := []string{`LISTEN "people"`, `UNLISTEN "people"`}; !slices.Equal(conn.execs, expect) {
+		t.Errorf("expect %q, got %q", expect, conn.execs)
+	}
+}
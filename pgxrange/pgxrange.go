@@ -0,0 +1,79 @@
+// Package pgxrange integrates the native interface of pgx with Go 1.23 range
+// functions, reusing the mapping of columns to struct fields of sqlrange.
+//
+// The package is a separate module so programs using sqlrange with
+// database/sql do not depend on pgx.
+package pgxrange
+
+import (
+	"iter"
+	"reflect"
+
+	"github.com/achille-roussel/sqlrange"
+	"github.com/jackc/pgx/v5"
+)
+
+// Scan returns a sequence of rows decoded from a pgx.Rows value, for example:
+//
+//	rows, err := conn.Query(ctx, query, args...)
+//	if err != nil {
+//	  ...
+//	}
+//	for row, err := range pgxrange.Scan[RowType](rows) {
+//	  if err != nil {
+//	    ...
+//	  }
+//	  ...
+//	}
+//
+// The columns reported by the field descriptions of the rows are mapped to the
+// fields of Row as defined by [sqlrange.Fields], and the values are decoded by
+// pgx, which supports the types of its own type map. Columns that are not
+// mapped to any field are skipped.
+//
+// Only the column names of the "sql" tags are used: the tag options (such as
+// "enum", "sentinel", "extra", or "jsonpath"), the converters registered with
+// sqlrange, and the scan options and context hooks of sqlrange do not apply to
+// the rows decoded by this function.
+//
+// The returned function automatically closes the rows when it completes its
+// iteration.
+//
+// Ranging over the returned function will panic if the type parameter is not a
+// struct.
+func Scan[Row any](rows pgx.Rows) iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		defer rows.Close()
+		var zero Row
+
+		fields := rows.FieldDescriptions()
+		// A nil destination instructs pgx to skip the column.
+		scanArgs := make([]any, len(fields))
+		row := new(Row)
+		val := reflect.ValueOf(row).Elem()
+
+		for columnName, structField := range sqlrange.Fields(val.Type()) {
+			for columnIndex, f := range fields {
+				if f.Name == columnName {
+					scanArgs[columnIndex] = val.FieldByIndex(structField.Index).Addr().Interface()
+					break
+				}
+			}
+		}
+
+		for rows.Next() {
+			if err := rows.Scan(scanArgs...); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(*row, nil) {
+				return
+			}
+			*row = zero
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package pgxrange_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/achille-roussel/sqlrange/pgxrange"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type person struct {
+	Age  int    `sql:"age"`
+	Name string `sql:"name"`
+}
+
+// stubRows is a pgx.Rows yielding a fixed list of values, it assigns the
+// values to destinations of type *int and *string, and skips nil ones like
+// pgx does.
+type stubRows struct {
+	pgx.Rows
+	columns []string
+	values  [][]any
+	index   int
+	closed  bool
+	err     error
+}
+
+func (r *stubRows) FieldDescriptions() []pgconn.FieldDescription {
+	fields := make([]pgconn.FieldDescription, len(r.columns))
+	for i, name := range r.columns {
+		fields[i].Name = name
+	}
+	return fields
+}
+
+func (r *stubRows) Next() bool {
+	if r.index == len(r.values) {
+		return false
+	}
+	r.index++
+	return true
+}
+
+func (r *stubRows) Scan(dest ...any) error {
+	for i, value := range r.values[r.index-1] {
+		switch d := dest[i].(type) {
+		case nil:
+		case *int:
+			*d = value.(int)
+		case *string:
+			*d = value.(string)
+		default:
+			return errors.New("unsupported destination")
+		}
+	}
+	return nil
+}
+
+func (r *stubRows) Err() error { return r.err }
+
+func (r *stubRows) Close() { r.closed = true }
+
+func TestScan(t *testing.T) {
+	rows := &stubRows{
+		columns: []string{"id", "name", "age"},
+		values: [][]any{
+			{1, "Alice", 1},
+			{2, "Bob", 2},
+		},
+	}
+
+	var people []person
+	for p, err := range pgxrange.Scan[person](rows) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		people = append(people, p)
+	}
+
+	expect := []person{{Age: 1, Name: "Alice"}, {Age: 2, Name: "Bob"}}
+	if !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+	if !rows.closed {
+		t.Error("rows were not closed")
+	}
+}
+
+func TestScanError(t *testing.T) {
+	errBroken := errors.New("broken")
+	rows := &stubRows{columns: []string{"name"}, err: errBroken}
+
+	for _, err := range pgxrange.Scan[person](rows) {
+		if !errors.Is(err, errBroken) {
+			t.Errorf("expect %v, got %v", errBroken, err)
+		}
+	}
+	if !rows.closed {
+		t.Error("rows were not closed")
+	}
+}
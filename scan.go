@@ -0,0 +1,1595 @@
+package sqlrange
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unsafe"
+)
+
+// ScanOption is a functional option type to configure the [Scan] function.
+//
+// Options can also be passed to [Query] and [QueryContext] among the query
+// arguments, in which case they apply to scanning the results and are not
+// passed to the database.
+type ScanOption func(*scanOptions)
+
+// ScanNullStructs is an option enabling the mapping of columns to
+// pointer-to-struct fields, which are set to nil when all their columns are
+// NULL.
+//
+// This option is useful to model the optional side of a LEFT JOIN, for example:
+//
+//	type Manager struct {
+//	  ManagerName string `sql:"manager_name"`
+//	}
+//
+//	type Employee struct {
+//	  Name    string `sql:"name"`
+//	  Manager *Manager
+//	}
+//
+// When the row has NULL values in all the columns of the struct, the pointer is
+// left nil, otherwise a new value is allocated and populated with the columns.
+// Note that a NULL column still fails to scan into a non-nullable field when
+// some of the other columns of the struct are not NULL.
+//
+// Only pointer-to-struct fields at the top level of the Row type are
+// considered, either embedded or named without a "sql" tag, since tagged fields
+// are mapped to a single column. The columns already mapped to other fields
+// take precedence.
+func ScanNullStructs() ScanOption {
+	return func(opts *scanOptions) { opts.nullStructs = true }
+}
+
+// Setter is an interface implemented by types that receive column values via a
+// method call when scanning rows with the [ScanSetters] option enabled.
+//
+// SetSQL receives the value returned by the driver, which may be nil for NULL
+// columns. As with [sql.Scanner], byte slices are owned by the driver and must
+// be copied if the method needs to retain them.
+type Setter interface {
+	SetSQL(value any) error
+}
+
+// ScanSetters is an option enabling the assignment of column values to fields
+// whose pointer type implements the [Setter] interface.
+//
+// This is useful for immutable types with unexported fields, which do not want
+// to expose pointer mutation semantics via [sql.Scanner]. Types implementing
+// both [sql.Scanner] and [Setter] are still scanned via their Scan method.
+func ScanSetters() ScanOption {
+	return func(opts *scanOptions) { opts.setters = true }
+}
+
+// ScanRawBytes is an option which avoids copying the values of columns scanned
+// into fields of type []byte or string, by using [sql.RawBytes] to reference
+// the memory of the driver directly.
+//
+// This is an expert feature to reduce memory allocations when streaming rows
+// without retaining them. The values of []byte and string fields are only valid
+// until the iteration moves to the next row, after which the driver may reuse
+// the memory they point to. Programs using this option must consume the rows
+// immediately, and copy the values that they need to retain, for example:
+//
+//	for row, err := range sqlrange.Query[Row](db, query, sqlrange.ScanRawBytes()) {
+//	  if err != nil {
+//	    ...
+//	  }
+//	  // row.Name must not be used after this iteration of the loop, unless
+//	  // it is copied with strings.Clone.
+//	  names[strings.Clone(row.Name)]++
+//	}
+//
+// Note that with this option, NULL values are scanned as empty strings into
+// fields of type string.
+func ScanRawBytes() ScanOption {
+	return func(opts *scanOptions) { opts.rawBytes = true }
+}
+
+// ScanMaxBytes is an option limiting the size of the string and []byte values
+// returned by the driver, which guards programs against pathological rows, for
+// example with huge BLOB columns:
+//
+//	for row, err := range sqlrange.Query[Row](db, query, sqlrange.ScanMaxBytes(1<<20)) {
+//	  ...
+//	}
+//
+// The values of each row are measured before they are scanned into the fields,
+// whatever their types (for example json.RawMessage, sql.NullString, or types
+// implementing sql.Scanner), or into the values of map rows, so values
+// exceeding n bytes are never copied. The iteration yields an error wrapping
+// [ErrValueTooLarge] and naming the column when a value is larger than n
+// bytes, including for columns which are not mapped to any field.
+//
+// A limit of zero or less disables the option.
+func ScanMaxBytes(n int) ScanOption {
+	return func(opts *scanOptions) { opts.maxBytes = n }
+}
+
+// ErrValueTooLarge is the error returned when a column value exceeds the limit
+// set by the [ScanMaxBytes] option.
+var ErrValueTooLarge = errors.New("value too large")
+
+// ScanLooseNumbers is an option relaxing the parsing of numbers returned as
+// strings by the driver when they are scanned into integer and floating point
+// fields.
+//
+// The standard library already converts strings like "42" to numbers, but it
+// rejects representations produced by some drivers, such as the text protocol
+// of MySQL returning DECIMAL columns as "42.00", or values padded with spaces.
+// With this option enabled, leading and trailing white spaces are ignored, and
+// integer fields accept decimal numbers as long as they have no fractional
+// part. Values which would be truncated or overflow the field still produce an
+// error.
+//
+// The option is disabled by default to avoid hiding type mismatches between the
+// columns and the fields of the Row type.
+func ScanLooseNumbers() ScanOption {
+	return func(opts *scanOptions) { opts.looseNumbers = true }
+}
+
+// ScanNumberBase is an option setting the base in which integer fields are
+// parsed from the strings returned by the driver, for schemas storing numbers
+// as hexadecimal or octal text. The option enables [ScanLooseNumbers], for
+// example:
+//
+//	for row, err := range sqlrange.Query[Row](db, query, sqlrange.ScanNumberBase(16)) {
+//	  ...
+//	}
+//
+// The strings may have the prefix of the base, such as "0x" for base 16, "0o"
+// for base 8, and "0b" for base 2, so both "ff" and "0xFF" are parsed as 255.
+// The base does not apply to floating point fields, nor to values returned as
+// numbers by the driver. In bases other than 10, integer fields do not accept
+// decimal numbers with a fractional part.
+//
+// The function panics if the base is not between 2 and 36.
+func ScanNumberBase(base int) ScanOption {
+	if base < 2 || base > 36 {
+		panic(fmt.Errorf("invalid number base: %d", base))
+	}
+	return func(opts *scanOptions) {
+		opts.looseNumbers = true
+		opts.numberBase = base
+	}
+}
+
+// ScanFloatToInt is an option allowing integer fields to be scanned from the
+// floating point values returned by drivers which represent all numbers as
+// float64, such as drivers decoding JSON responses, or SQLite with columns that
+// have REAL affinity.
+//
+// The standard library only converts floating point values to integers when
+// their text representation is an integer, which fails for large values like
+// 1e+06. With this option enabled, the values are converted as long as they
+// have no fractional part and are in the range of the field, otherwise the
+// iteration yields an error. Values of other types are converted as usual.
+//
+// [ScanLooseNumbers] takes precedence over this option when both are used.
+func ScanFloatToInt() ScanOption {
+	return func(opts *scanOptions) { opts.floatToInt = true }
+}
+
+// ScanPrecisionWarning is an option calling warn when a value scanned into a
+// floating point field cannot be represented exactly, for example when a
+// NUMERIC column holds more significant digits than a float64 can store:
+//
+//	warn := func(column, raw string) {
+//	  log.Printf("%s: %s was rounded", column, raw)
+//	}
+//	for row, err := range sqlrange.Query[Row](db, query, sqlrange.ScanPrecisionWarning(warn)) {
+//	  ...
+//	}
+//
+// The function receives the name of the column and the text of the value
+// returned by the driver. It is only called for values returned as strings or
+// integers, values returned as floating point numbers by the driver have
+// already been rounded. The field is assigned the rounded value, and the
+// iteration continues.
+func ScanPrecisionWarning(warn func(column, raw string)) ScanOption {
+	return func(opts *scanOptions) { opts.precisionWarning = warn }
+}
+
+// ScanNoClose is an option leaving the responsibility of closing the rows to
+// the caller of [Scan], which is useful to consume multiple result sets:
+//
+//	for user, err := range sqlrange.Scan[User](rows, sqlrange.ScanNoClose()) {
+//	  ...
+//	}
+//	if rows.NextResultSet() {
+//	  for order, err := range sqlrange.Scan[Order](rows) {
+//	    ...
+//	  }
+//	}
+//
+// Programs using this option must ensure that the rows are eventually closed,
+// otherwise the database connection that they hold is never released. This is
+// especially important when the iteration stops early, since the rows are only
+// closed automatically by [sql.Rows.Next] after reaching the end of the last
+// result set.
+//
+// The option has no effect when passed to [Query] or [QueryContext], which
+// always close the rows that they create.
+func ScanNoClose() ScanOption {
+	return func(opts *scanOptions) { opts.noClose = true }
+}
+
+// ScanOnlyFields is an option restricting the scan to the fields mapped to the
+// given column names, which is useful to reuse a wide struct type for queries
+// selecting only some of its columns:
+//
+//	for user, err := range sqlrange.Query[User](db, query,
+//	  sqlrange.ScanOnlyFields("id", "name"),
+//	) {
+//	  ...
+//	}
+//
+// The columns of the result set which are not in the list are discarded, even
+// if they match other fields of the Row type, which are left to their zero
+// value. This includes the columns that would otherwise be captured by the
+// [ScanNullStructs] option or a field with the "extra" tag option.
+//
+// The iteration yields an error if one of the names is not mapped to any field
+// of the Row type.
+func ScanOnlyFields(columns ...string) ScanOption {
+	return func(opts *scanOptions) { opts.onlyFields = append(opts.onlyFields, columns...) }
+}
+
+// ScanCombine is an option setting a field from the values of multiple columns
+// combined by a function, for example:
+//
+//	type User struct {
+//	  FullName string `sql:"full_name"`
+//	}
+//
+//	for user, err := range sqlrange.Query[User](db,
+//	  `SELECT first_name, last_name FROM users`,
+//	  sqlrange.ScanCombine("full_name", []string{"first_name", "last_name"},
+//	    func(values []any) any {
+//	      return fmt.Sprintf("%s %s", values[0], values[1])
+//	    },
+//	  ),
+//	) {
+//	  ...
+//	}
+//
+// The field is designated by the column name of its "sql" tag. The function
+// receives the values of the columns in the order they were listed, as returned
+// by [sql.Rows.Scan] for destinations of type *any, and its return value must be
+// assignable to the field, or nil to leave the field to its zero value. The
+// columns may also be mapped to other fields of the Row type, which are
+// populated as usual.
+//
+// The iteration yields an error if the field does not exist in the Row type, or
+// if one of the columns is missing from the result set.
+func ScanCombine(field string, columns []string, fn func([]any) any) ScanOption {
+	return func(opts *scanOptions) {
+		opts.combines = append(opts.combines, scanCombine{field, columns, fn})
+	}
+}
+
+// ScanDefaults is an option setting the fields of the Row type to default
+// values when their columns are absent from the result set, instead of leaving
+// them to their zero value, for example:
+//
+//	for user, err := range sqlrange.Query[User](db, `SELECT id, name FROM users`,
+//	  sqlrange.ScanDefaults(map[string]any{"status": "active"}),
+//	) {
+//	  ...
+//	}
+//
+// The map is keyed by the column names that the fields are mapped to, and the
+// values must be assignable to the fields. The defaults also apply to the fields
+// excluded by the [ScanOnlyFields] option. Columns present in the result set are
+// always scanned, even when they are NULL, see [ScanCoalesce] to replace NULL
+// values.
+//
+// The iteration yields an error if one of the names is not mapped to any field
+// of the Row type, or if a value cannot be assigned to its field.
+func ScanDefaults(defaults map[string]any) ScanOption {
+	return func(opts *scanOptions) {
+		if opts.defaults == nil {
+			opts.defaults = make(map[string]any, len(defaults))
+		}
+		for column, value := range defaults {
+			opts.defaults[column] = value
+		}
+	}
+}
+
+// ScanCoalesce is an option setting the fields of the Row type to default
+// values when their columns are NULL, which is the equivalent of wrapping the
+// columns with COALESCE in the query, for example:
+//
+//	for user, err := range sqlrange.Query[User](db, `SELECT id, name, status FROM users`,
+//	  sqlrange.ScanCoalesce(map[string]any{"status": "active"}),
+//	) {
+//	  ...
+//	}
+//
+// The map is keyed by the column names that the fields are mapped to, and the
+// values must be assignable to the fields. Fields of pointer types and types
+// implementing [sql.Scanner] are also assigned the defaults, instead of being
+// scanned from the NULL values. The option does not apply to columns absent
+// from the result set, see [ScanDefaults] for those.
+//
+// The iteration yields an error if one of the names is not mapped to any field
+// of the Row type, or if a value cannot be assigned to its field.
+func ScanCoalesce(defaults map[string]any) ScanOption {
+	return func(opts *scanOptions) {
+		if opts.coalesce == nil {
+			opts.coalesce = make(map[string]any, len(defaults))
+		}
+		for column, value := range defaults {
+			opts.coalesce[column] = value
+		}
+	}
+}
+
+// ScanTimeLocation is an option converting the values scanned into fields of
+// type time.Time (or *time.Time) to the given location, which normalizes the
+// timestamps returned by drivers in UTC, in the local time zone, or with a fixed
+// offset. The conversion does not change the instant that the values represent,
+// only the location used to display them, and zero values are left unchanged.
+//
+// The option overrides the default location set with [SetDefaultTimeLocation].
+func ScanTimeLocation(loc *time.Location) ScanOption {
+	return func(opts *scanOptions) { opts.timeLocation = loc }
+}
+
+// ScanTimeLayout is an option parsing the strings returned by the driver for
+// fields of type time.Time (or *time.Time) with the given layout, as defined by
+// [time.Parse], which is needed with drivers returning timestamps as text, for
+// example SQLite:
+//
+//	for row, err := range sqlrange.Query[Row](db, query, sqlrange.ScanTimeLayout(time.DateTime)) {
+//	  ...
+//	}
+//
+// Timestamps without time zone are parsed in the location set by
+// [ScanTimeLocation], or in UTC if there are none. The values returned as
+// time.Time by the driver are assigned unchanged.
+//
+// The option overrides the default layout set with [SetDefaultTimeLayout].
+func ScanTimeLayout(layout string) ScanOption {
+	return func(opts *scanOptions) { opts.timeLayout = layout }
+}
+
+var (
+	defaultTimeLayout   atomic.Pointer[string]
+	defaultTimeLocation atomic.Pointer[time.Location]
+)
+
+// SetDefaultTimeLayout sets the layout used by [Scan] and [Query] when no
+// [ScanTimeLayout] option is passed, which allows programs to configure it once
+// for drivers that always return timestamps as text, for example at init:
+//
+//	func init() {
+//	  sqlrange.SetDefaultTimeLayout(time.DateTime)
+//	}
+//
+// An empty layout restores the default behavior of not parsing strings.
+//
+// The function is safe to call concurrently with scans, which use the layout
+// set when their iteration starts.
+func SetDefaultTimeLayout(layout string) {
+	defaultTimeLayout.Store(&layout)
+}
+
+// SetDefaultTimeLocation sets the location used by [Scan] and [Query] when no
+// [ScanTimeLocation] option is passed. A nil location restores the default
+// behavior of leaving times in the location returned by the driver.
+//
+// The function is safe to call concurrently with scans, which use the location
+// set when their iteration starts.
+func SetDefaultTimeLocation(loc *time.Location) {
+	defaultTimeLocation.Store(loc)
+}
+
+// ScanTrimColumns is an option normalizing the column names reported by the
+// driver before matching them with the fields of the Row type, by removing
+// leading and trailing white spaces and UTF-8 byte order marks.
+//
+// This is useful with tables imported from CSV files or with ODBC bridges,
+// which may report column names such as " name" or "\uFEFFid".
+func ScanTrimColumns() ScanOption {
+	return func(opts *scanOptions) { opts.trimColumns = true }
+}
+
+// trimColumns returns a copy of the column names without white spaces and byte
+// order marks.
+func trimColumns(columns []string) []string {
+	trimmed := make([]string, len(columns))
+	for i, column := range columns {
+		trimmed[i] = strings.TrimFunc(column, func(r rune) bool {
+			return r == '\uFEFF' || unicode.IsSpace(r)
+		})
+	}
+	return trimmed
+}
+
+type scanCombine struct {
+	field   string
+	columns []string
+	fn      func([]any) any
+}
+
+type scanOptions struct {
+	nullStructs  bool
+	setters      bool
+	rawBytes     bool
+	maxBytes     int
+	looseNumbers bool
+	numberBase   int
+	floatToInt   bool
+	noClose      bool
+	onlyFields   []string
+	combines     []scanCombine
+	defaults     map[string]any
+	coalesce     map[string]any
+	timeLocation *time.Location
+	timeLayout   string
+	trimColumns  bool
+	// precisionWarning is the function set by ScanPrecisionWarning.
+	precisionWarning func(column, raw string)
+}
+
+// skip reports whether the field mapped to a column must be left out of the
+// scan.
+func (opts *scanOptions) skip(column string) bool {
+	return opts.onlyFields != nil && !slices.Contains(opts.onlyFields, column)
+}
+
+// discardUnmapped sets the scan destination of columns that are not mapped to
+// any field to discard their values, when the ScanOnlyFields option is used.
+//
+// The function returns an error if one of the fields listed in the option does
+// not exist in the Row type.
+func (opts *scanOptions) discardUnmapped(fields []field, scanArgs []any) error {
+	if opts.onlyFields == nil {
+		return nil
+	}
+	for _, name := range opts.onlyFields {
+		if !slices.ContainsFunc(fields, func(f field) bool { return f.name == name }) {
+			return fmt.Errorf("column %q not found", name)
+		}
+	}
+	for i := range scanArgs {
+		if scanArgs[i] == nil {
+			scanArgs[i] = discard{}
+		}
+	}
+	return nil
+}
+
+// setDefaults returns a function assigning the default values of the fields
+// which are not scanned from the result set, or nil if there are none.
+func (opts *scanOptions) setDefaults(columns []string, val reflect.Value, fields []field) (func() error, error) {
+	if len(opts.defaults) == 0 {
+		return nil, nil
+	}
+
+	var fieldValues, defaultValues []reflect.Value
+
+	for _, name := range slices.Sorted(maps.Keys(opts.defaults)) {
+		fieldIndex := slices.IndexFunc(fields, func(f field) bool { return f.name == name })
+		if fieldIndex < 0 {
+			return nil, fmt.Errorf("column %q not found", name)
+		}
+		if fields[fieldIndex].columnIndex(columns) >= 0 && !opts.skip(name) {
+			continue
+		}
+		fieldValue := val.FieldByIndex(fields[fieldIndex].field.Index)
+		defaultValue := reflect.ValueOf(opts.defaults[name])
+		switch {
+		case !defaultValue.IsValid():
+			continue
+		case !defaultValue.Type().AssignableTo(fieldValue.Type()):
+			return nil, fmt.Errorf("cannot assign default value of type %s for %q to field of type %s", defaultValue.Type(), name, fieldValue.Type())
+		}
+		fieldValues = append(fieldValues, fieldValue)
+		defaultValues = append(defaultValues, defaultValue)
+	}
+
+	if len(fieldValues) == 0 {
+		return nil, nil
+	}
+	return func() error {
+		for i, fieldValue := range fieldValues {
+			fieldValue.Set(defaultValues[i])
+		}
+		return nil
+	}, nil
+}
+
+// scanCoalesce configures the scan arguments to record whether the columns of
+// the ScanCoalesce option are NULL, and returns a function to call after
+// scanning each row, which assigns the defaults to the fields of NULL columns
+// and rescans the others.
+//
+// The function returns nil if none of the columns are in the result set.
+func (opts *scanOptions) scanCoalesce(rows *sql.Rows, columns []string, val reflect.Value, fields []field, scanArgs []any) (func() error, error) {
+	if len(opts.coalesce) == 0 {
+		return nil, nil
+	}
+
+	var columnIndexes []int
+	var fieldValues, defaultValues []reflect.Value
+	var dests []any
+
+	for _, name := range slices.Sorted(maps.Keys(opts.coalesce)) {
+		fieldIndex := slices.IndexFunc(fields, func(f field) bool { return f.name == name })
+		if fieldIndex < 0 {
+			return nil, fmt.Errorf("column %q not found", name)
+		}
+		columnIndex := fields[fieldIndex].columnIndex(columns)
+		if columnIndex < 0 || opts.skip(name) {
+			continue
+		}
+		fieldValue := val.FieldByIndex(fields[fieldIndex].field.Index)
+		defaultValue := reflect.ValueOf(opts.coalesce[name])
+		switch {
+		case !defaultValue.IsValid():
+			defaultValue = reflect.Zero(fieldValue.Type())
+		case !defaultValue.Type().AssignableTo(fieldValue.Type()):
+			return nil, fmt.Errorf("cannot assign default value of type %s for %q to field of type %s", defaultValue.Type(), name, fieldValue.Type())
+		}
+		columnIndexes = append(columnIndexes, columnIndex)
+		fieldValues = append(fieldValues, fieldValue)
+		defaultValues = append(defaultValues, defaultValue)
+		dests = append(dests, scanArgs[columnIndex])
+	}
+
+	if len(columnIndexes) == 0 {
+		return nil, nil
+	}
+
+	nulls := make([]nullCheck, len(columnIndexes))
+	for i, columnIndex := range columnIndexes {
+		scanArgs[columnIndex] = &nulls[i]
+	}
+
+	rescanArgs := make([]any, len(columns))
+	return func() error {
+		rescan := false
+		for i := range rescanArgs {
+			rescanArgs[i] = discard{}
+		}
+		for i, columnIndex := range columnIndexes {
+			if nulls[i].null {
+				fieldValues[i].Set(defaultValues[i])
+			} else {
+				rescanArgs[columnIndex] = dests[i]
+				rescan = true
+			}
+		}
+		if !rescan {
+			return nil
+		}
+		return rows.Scan(rescanArgs...)
+	}, nil
+}
+
+// dest returns the destination passed to [sql.Rows.Scan] for a struct field,
+// accounting for the scan options.
+func (opts *scanOptions) dest(fieldValue reflect.Value) any {
+	if opts.setters {
+		switch v := fieldValue.Addr().Interface().(type) {
+		case sql.Scanner:
+		case Setter:
+			return setterDest{v}
+		}
+	}
+	if opts.looseNumbers && isNumber(fieldValue.Kind()) && converterOf(fieldValue.Type()) == nil {
+		if _, ok := fieldValue.Addr().Interface().(sql.Scanner); !ok {
+			return looseNumber{fieldValue, opts.numberBase}
+		}
+	}
+	if opts.timeLayout != "" && (fieldValue.Type() == timeType || fieldValue.Type() == timePointerType) {
+		return timeLayoutValue{fieldValue, opts.timeLayout, opts.timeLocation}
+	}
+	if opts.floatToInt && isInteger(fieldValue.Kind()) && converterOf(fieldValue.Type()) == nil {
+		if _, ok := fieldValue.Addr().Interface().(sql.Scanner); !ok {
+			return floatToInt{fieldValue}
+		}
+	}
+	return scanDest(fieldValue)
+}
+
+var timePointerType = reflect.TypeOf((*time.Time)(nil))
+
+// timeLayoutValue is a [sql.Scanner] assigning time.Time and *time.Time fields
+// from strings formatted with a layout, when the ScanTimeLayout option is used.
+type timeLayoutValue struct {
+	value  reflect.Value
+	layout string
+	loc    *time.Location
+}
+
+func (v timeLayoutValue) Scan(src any) error {
+	var t time.Time
+	var err error
+	switch x := src.(type) {
+	case nil:
+		if v.value.Kind() != reflect.Pointer {
+			return fmt.Errorf("converting NULL to %s is unsupported", v.value.Type())
+		}
+		v.value.SetZero()
+		return nil
+	case time.Time:
+		t = x
+	case string:
+		t, err = v.parse(x)
+	case []byte:
+		t, err = v.parse(string(x))
+	default:
+		return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type %s", src, v.value.Type())
+	}
+	if err != nil {
+		return err
+	}
+	if v.value.Kind() == reflect.Pointer {
+		v.value.Set(reflect.ValueOf(&t))
+	} else {
+		v.value.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
+
+func (v timeLayoutValue) parse(s string) (time.Time, error) {
+	loc := v.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.ParseInLocation(v.layout, s, loc)
+}
+
+// precisionCheck is a [sql.Scanner] wrapping the destination of a floating
+// point field to call the function of the ScanPrecisionWarning option when a
+// value cannot be represented exactly by the field.
+type precisionCheck struct {
+	column string
+	value  reflect.Value
+	dest   any
+	warn   func(column, raw string)
+}
+
+func (c precisionCheck) Scan(src any) error {
+	var raw string
+	switch v := src.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	case int64:
+		raw = strconv.FormatInt(v, 10)
+	}
+
+	if scanner, ok := c.dest.(sql.Scanner); ok {
+		if err := scanner.Scan(src); err != nil {
+			return err
+		}
+	} else {
+		var f sql.Null[float64]
+		if err := f.Scan(src); err != nil {
+			return err
+		}
+		if !f.Valid {
+			return fmt.Errorf("converting NULL to %s is unsupported", c.value.Kind())
+		}
+		if c.value.OverflowFloat(f.V) {
+			return fmt.Errorf("converting driver.Value type %T (%q) to a %s: %w", src, raw, c.value.Kind(), strconv.ErrRange)
+		}
+		c.value.SetFloat(f.V)
+	}
+
+	if raw != "" && !isExact(strings.TrimSpace(raw), c.value.Float()) {
+		c.warn(c.column, raw)
+	}
+	return nil
+}
+
+// isExact reports whether the decimal number in s is exactly equal to f. It
+// returns true if s is not a valid number, since the value was then assigned
+// by a scanner accepting other representations.
+func isExact(s string, f float64) bool {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return true
+	}
+	x := new(big.Rat).SetFloat64(f)
+	return x != nil && r.Cmp(x) == 0
+}
+
+// setterDest is a [sql.Scanner] adapting the [Setter] interface.
+type setterDest struct{ setter Setter }
+
+func (d setterDest) Scan(src any) error { return d.setter.SetSQL(src) }
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isFloat(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+func isInteger(kind reflect.Kind) bool {
+	return isNumber(kind) && kind != reflect.Float32 && kind != reflect.Float64
+}
+
+// looseNumber is a [sql.Scanner] assigning numeric fields from the values of
+// the driver when the ScanLooseNumbers option is enabled.
+//
+// The base is the one in which integers are parsed from strings, zero means
+// base 10.
+type looseNumber struct {
+	value reflect.Value
+	base  int
+}
+
+func (n looseNumber) Scan(src any) error {
+	var s string
+	base := n.base
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case int64:
+		s, base = strconv.FormatInt(v, 10), 10
+	case float64:
+		s, base = strconv.FormatFloat(v, 'g', -1, 64), 10
+	default:
+		return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type %s", src, n.value.Type())
+	}
+
+	if err := n.parse(strings.TrimSpace(s), base); err != nil {
+		return fmt.Errorf("converting driver.Value type %T (%q) to a %s: %w", src, s, n.value.Kind(), err)
+	}
+	return nil
+}
+
+func (n looseNumber) parse(s string, base int) error {
+	bits := n.value.Type().Bits()
+	if base == 0 {
+		base = 10
+	} else if base != 10 {
+		s = trimBasePrefix(s, base)
+	}
+
+	switch n.value.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, bits)
+		if err != nil {
+			return err
+		}
+		n.value.SetFloat(f)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, base, bits)
+		if base == 10 && errors.Is(err, strconv.ErrSyntax) {
+			u, err = parseIntegral(s, func(f float64) (uint64, bool) {
+				u := uint64(f)
+				return u, f >= 0 && f < 1<<64 && !n.value.OverflowUint(u)
+			})
+		}
+		if err != nil {
+			return err
+		}
+		n.value.SetUint(u)
+		return nil
+
+	default:
+		i, err := strconv.ParseInt(s, base, bits)
+		if base == 10 && errors.Is(err, strconv.ErrSyntax) {
+			i, err = parseIntegral(s, func(f float64) (int64, bool) {
+				i := int64(f)
+				return i, f >= -1<<63 && f < 1<<63 && !n.value.OverflowInt(i)
+			})
+		}
+		if err != nil {
+			return err
+		}
+		n.value.SetInt(i)
+		return nil
+	}
+}
+
+// trimBasePrefix removes the prefix of the base from the number in s, after its
+// sign if any, because the functions of strconv only accept it in base 0.
+func trimBasePrefix(s string, base int) string {
+	sign := ""
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		sign, s = s[:1], s[1:]
+	}
+	if len(s) > 2 && s[0] == '0' {
+		switch c := s[1] | 0x20; {
+		case base == 16 && c == 'x', base == 8 && c == 'o', base == 2 && c == 'b':
+			s = s[2:]
+		}
+	}
+	return sign + s
+}
+
+var errFractional = errors.New("number has a fractional part")
+
+// parseIntegral parses s as a decimal number without fractional part, and
+// converts it to an integer with the convert function, which reports whether
+// the value is in the range of the field.
+func parseIntegral[T int64 | uint64](s string, convert func(float64) (T, bool)) (T, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) {
+		return 0, errFractional
+	}
+	i, ok := convert(f)
+	if !ok {
+		return 0, strconv.ErrRange
+	}
+	return i, nil
+}
+
+// floatToInt is a [sql.Scanner] assigning integer fields from floating point
+// values when the ScanFloatToInt option is enabled.
+type floatToInt struct{ value reflect.Value }
+
+func (n floatToInt) Scan(src any) error {
+	if f, ok := src.(float64); ok {
+		// The 'f' format does not use exponents, so the text is parsed as an
+		// integer when the value has no fractional part.
+		s := strconv.FormatFloat(f, 'f', -1, 64)
+		if err := (looseNumber{value: n.value}).parse(s, 10); err != nil {
+			return fmt.Errorf("converting driver.Value type float64 (%v) to a %s: %w", f, n.value.Kind(), err)
+		}
+		return nil
+	}
+
+	if src == nil {
+		return fmt.Errorf("converting NULL to %s is unsupported", n.value.Kind())
+	}
+
+	switch n.value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u sql.Null[uint64]
+		if err := u.Scan(src); err != nil {
+			return err
+		}
+		if n.value.OverflowUint(u.V) {
+			return fmt.Errorf("converting driver.Value type %T (%v) to a %s: %w", src, src, n.value.Kind(), strconv.ErrRange)
+		}
+		n.value.SetUint(u.V)
+	default:
+		var i sql.Null[int64]
+		if err := i.Scan(src); err != nil {
+			return err
+		}
+		if n.value.OverflowInt(i.V) {
+			return fmt.Errorf("converting driver.Value type %T (%v) to a %s: %w", src, src, n.value.Kind(), strconv.ErrRange)
+		}
+		n.value.SetInt(i.V)
+	}
+	return nil
+}
+
+func newScanOptions(opts []ScanOption) *scanOptions {
+	options := new(scanOptions)
+	if layout := defaultTimeLayout.Load(); layout != nil {
+		options.timeLayout = *layout
+	}
+	options.timeLocation = defaultTimeLocation.Load()
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// splitScanOptions separates the scan options from the query arguments.
+//
+// The function returns the original slice when it contains no options, so the
+// common case does not allocate.
+func splitScanOptions(args []any) ([]any, []ScanOption) {
+	n := 0
+	for _, arg := range args {
+		if _, ok := arg.(ScanOption); ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return args, nil
+	}
+	queryArgs := make([]any, 0, len(args)-n)
+	scanOpts := make([]ScanOption, 0, n)
+	for _, arg := range args {
+		if opt, ok := arg.(ScanOption); ok {
+			scanOpts = append(scanOpts, opt)
+		} else {
+			queryArgs = append(queryArgs, arg)
+		}
+	}
+	return queryArgs, scanOpts
+}
+
+// nullStruct represents a pointer-to-struct field mapped to a group of columns
+// when the ScanNullStructs option is enabled.
+type nullStruct struct {
+	index   []int        // index of the pointer field in the Row type
+	elem    reflect.Type // type of the struct that the field points to
+	columns []int        // indexes of the columns mapped to the struct
+	fields  [][]int      // indexes of the struct fields mapped to the columns
+	nulls   []nullCheck  // NULL-ness of the columns of the current row
+}
+
+// nullCheck is a [sql.Scanner] recording whether a column value was NULL.
+type nullCheck struct{ null bool }
+
+func (c *nullCheck) Scan(src any) error {
+	c.null = src == nil
+	return nil
+}
+
+// scanNullStructs configures the scan arguments to record the NULL-ness of the
+// columns mapped to pointer-to-struct fields, and returns a function
+// to call after scanning each row, which populates the fields of the structs
+// that had at least one non-NULL column.
+//
+// The function returns nil if the row has no such fields.
+func scanNullStructs(rows *sql.Rows, columns []string, val reflect.Value, scanArgs []any, hooks *hooks) func() error {
+	var groups []*nullStruct
+
+	t := val.Type()
+	for i, n := 0, t.NumField(); i < n; i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Type.Kind() != reflect.Pointer || f.Type.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		// Tagged fields which are not embedded are mapped to a single column.
+		if s, tagged := lookupTag(f.Tag, hooks.tagKeys()); tagged && (s == "-" || !f.Anonymous) {
+			continue
+		}
+		g := &nullStruct{index: f.Index, elem: f.Type.Elem()}
+		for _, sf := range hooks.fields(g.elem) {
+			if columnIndex := slices.Index(columns, sf.name); columnIndex >= 0 && scanArgs[columnIndex] == nil {
+				g.columns = append(g.columns, columnIndex)
+				g.fields = append(g.fields, sf.field.Index)
+			}
+		}
+		if len(g.columns) > 0 {
+			g.nulls = make([]nullCheck, len(g.columns))
+			for j, columnIndex := range g.columns {
+				scanArgs[columnIndex] = &g.nulls[j]
+			}
+			groups = append(groups, g)
+		}
+	}
+
+	if len(groups) == 0 {
+		return nil
+	}
+
+	rescanArgs := make([]any, len(columns))
+	return func() error {
+		rescan := false
+		for i := range rescanArgs {
+			rescanArgs[i] = discard{}
+		}
+		for _, g := range groups {
+			if !slices.ContainsFunc(g.nulls, func(c nullCheck) bool { return !c.null }) {
+				continue
+			}
+			elem := reflect.New(g.elem)
+			for j, columnIndex := range g.columns {
+				rescanArgs[columnIndex] = scanDest(elem.Elem().FieldByIndex(g.fields[j]))
+			}
+			val.FieldByIndex(g.index).Set(elem)
+			rescan = true
+		}
+		if !rescan {
+			return nil
+		}
+		return rows.Scan(rescanArgs...)
+	}
+}
+
+// scanCombines configures the scan arguments for the columns used by the
+// ScanCombine options, and returns a function to call after scanning each row,
+// which rescans the columns and assigns the combined values to the fields.
+//
+// The function returns nil if there are no options.
+func scanCombines(rows *sql.Rows, columns []string, val reflect.Value, fields []field, scanArgs []any, combines []scanCombine) (func() error, error) {
+	if len(combines) == 0 {
+		return nil, nil
+	}
+
+	fieldValues := make([]reflect.Value, len(combines))
+	columnIndexes := make([][]int, len(combines))
+
+	for i, c := range combines {
+		fieldIndex := slices.IndexFunc(fields, func(f field) bool { return f.name == c.field })
+		if fieldIndex < 0 {
+			return nil, fmt.Errorf("column %q not found", c.field)
+		}
+		fieldValues[i] = val.FieldByIndex(fields[fieldIndex].field.Index)
+
+		columnIndexes[i] = make([]int, len(c.columns))
+		for j, column := range c.columns {
+			columnIndex := slices.Index(columns, column)
+			if columnIndex < 0 {
+				return nil, fmt.Errorf("column %q combined into %q is missing from the result set", column, c.field)
+			}
+			if scanArgs[columnIndex] == nil {
+				scanArgs[columnIndex] = discard{}
+			}
+			columnIndexes[i][j] = columnIndex
+		}
+	}
+
+	values := make([]any, len(columns))
+	rescanArgs := make([]any, len(columns))
+	for i := range rescanArgs {
+		rescanArgs[i] = discard{}
+	}
+	for _, indexes := range columnIndexes {
+		for _, columnIndex := range indexes {
+			rescanArgs[columnIndex] = &values[columnIndex]
+		}
+	}
+
+	return func() error {
+		if err := rows.Scan(rescanArgs...); err != nil {
+			return err
+		}
+		for i, c := range combines {
+			args := make([]any, len(columnIndexes[i]))
+			for j, columnIndex := range columnIndexes[i] {
+				args[j] = values[columnIndex]
+			}
+			fieldValue := fieldValues[i]
+			switch v := c.fn(args); {
+			case v == nil:
+				fieldValue.SetZero()
+			case reflect.TypeOf(v).AssignableTo(fieldValue.Type()):
+				fieldValue.Set(reflect.ValueOf(v))
+			default:
+				return fmt.Errorf("cannot assign value of type %T combined into %q to field of type %s", v, c.field, fieldValue.Type())
+			}
+		}
+		return nil
+	}, nil
+}
+
+// scanTimeLocation returns a function to call after scanning each row, which
+// converts the time.Time fields referenced by the scan arguments to loc.
+//
+// The function returns nil if there are no such fields.
+func scanTimeLocation(scanArgs []any, loc *time.Location) func() error {
+	var times []*time.Time
+	var timePointers []**time.Time
+
+	for _, arg := range scanArgs {
+		if v, ok := arg.(timeLayoutValue); ok {
+			arg = v.value.Addr().Interface()
+		}
+		switch p := arg.(type) {
+		case *time.Time:
+			times = append(times, p)
+		case **time.Time:
+			timePointers = append(timePointers, p)
+		}
+	}
+
+	if len(times) == 0 && len(timePointers) == 0 {
+		return nil
+	}
+
+	return func() error {
+		for _, t := range times {
+			if !t.IsZero() {
+				*t = t.In(loc)
+			}
+		}
+		for _, p := range timePointers {
+			if t := *p; t != nil && !t.IsZero() {
+				*t = t.In(loc)
+			}
+		}
+		return nil
+	}
+}
+
+var extraType = reflect.TypeOf(map[string]any(nil))
+
+// extraField returns the index of the field of a struct type which has the
+// "extra" option in the first of the tag keys present, or nil if there are
+// none.
+func extraField(t reflect.Type, index []int, tags []string) []int {
+	for i, n := 0, t.NumField(); i < n; i++ {
+		if f := t.Field(i); f.IsExported() {
+			s, tagged := lookupTag(f.Tag, tags)
+			if tagged && s == "-" {
+				continue
+			}
+			f.Index = append(slices.Clip(index), f.Index...)
+			if f.Anonymous {
+				if f.Type.Kind() == reflect.Struct {
+					if fieldIndex := extraField(f.Type, f.Index, tags); fieldIndex != nil {
+						return fieldIndex
+					}
+				}
+			} else if tagged {
+				if _, options := parseTag(s); options.contains("extra") {
+					return f.Index
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// scanExtra configures the scan arguments to capture the values of unmapped
+// columns when the row has a field with the "extra" tag option, and returns a
+// function to call after scanning each row, which stores them in the map held
+// by the field.
+//
+// The function returns nil if the row has no such field, or if all the columns
+// are mapped to other fields. Tag options do not apply when the fields are
+// resolved by a [FieldResolver].
+func scanExtra(columns []string, val reflect.Value, scanArgs []any, hooks *hooks) (func() error, error) {
+	if hooks.resolveFields != nil {
+		return nil, nil
+	}
+	fieldIndex := extraField(val.Type(), nil, hooks.tagKeys())
+	if fieldIndex == nil {
+		return nil, nil
+	}
+
+	fieldValue := val.FieldByIndex(fieldIndex)
+	if fieldValue.Type() != extraType {
+		return nil, fmt.Errorf("field with the extra tag option must be of type %s, got %s", extraType, fieldValue.Type())
+	}
+
+	var extraColumns []int
+	for i := range scanArgs {
+		if scanArgs[i] == nil {
+			extraColumns = append(extraColumns, i)
+		}
+	}
+	if len(extraColumns) == 0 {
+		return nil, nil
+	}
+
+	extraValues := make([]any, len(extraColumns))
+	for i, columnIndex := range extraColumns {
+		scanArgs[columnIndex] = &extraValues[i]
+	}
+
+	return func() error {
+		extra := make(map[string]any, len(extraColumns))
+		for i, columnIndex := range extraColumns {
+			extra[columns[columnIndex]] = extraValues[i]
+		}
+		fieldValue.Set(reflect.ValueOf(extra))
+		return nil
+	}, nil
+}
+
+// jsonPathField is a struct field with the "jsonpath" tag option.
+type jsonPathField struct {
+	column string
+	path   string
+	index  []int
+}
+
+// jsonPathFields returns the fields of a struct type which have the "jsonpath"
+// option in the first of the tag keys present.
+func jsonPathFields(t reflect.Type, index []int, fields []jsonPathField, tags []string) []jsonPathField {
+	for i, n := 0, t.NumField(); i < n; i++ {
+		if f := t.Field(i); f.IsExported() {
+			s, tagged := lookupTag(f.Tag, tags)
+			if tagged && s == "-" {
+				continue
+			}
+			f.Index = append(slices.Clip(index), f.Index...)
+			if f.Anonymous {
+				if f.Type.Kind() == reflect.Struct {
+					fields = jsonPathFields(f.Type, f.Index, fields, tags)
+				}
+			} else if tagged {
+				name, options := parseTag(s)
+				if path, ok := options.value("jsonpath"); ok {
+					fields = append(fields, jsonPathField{name, path, f.Index})
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// scanJSONPaths configures the scan of the json columns that fields with the
+// "jsonpath" tag option are extracted from, and returns a function to call
+// after scanning each row, which decodes the documents and assigns the fields.
+//
+// The columns are scanned again after the row, so they may also be mapped to
+// other fields. The function returns nil if the row has no such fields, or if
+// their columns are missing from the result set. Tag options do not apply when
+// the fields are resolved by a [FieldResolver].
+func scanJSONPaths(rows *sql.Rows, columns []string, val reflect.Value, scanArgs []any, hooks *hooks) (func() error, error) {
+	if hooks.resolveFields != nil {
+		return nil, nil
+	}
+
+	type pathField struct {
+		column int
+		path   []any
+		value  reflect.Value
+	}
+
+	var fields []pathField
+	for _, f := range jsonPathFields(val.Type(), nil, nil, hooks.tagKeys()) {
+		path, err := parseJSONPath(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", f.column, err)
+		}
+		if columnIndex := slices.Index(columns, f.column); columnIndex >= 0 {
+			fields = append(fields, pathField{columnIndex, path, val.FieldByIndex(f.index)})
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	docs := make([][]byte, len(columns))
+	rescanArgs := make([]any, len(columns))
+	for i := range rescanArgs {
+		rescanArgs[i] = discard{}
+	}
+	for _, f := range fields {
+		rescanArgs[f.column] = (*sql.RawBytes)(&docs[f.column])
+		if scanArgs[f.column] == nil {
+			scanArgs[f.column] = discard{}
+		}
+	}
+
+	values := make([]any, len(columns))
+	return func() error {
+		if err := rows.Scan(rescanArgs...); err != nil {
+			return err
+		}
+		for i, doc := range docs {
+			values[i] = nil
+			if doc != nil {
+				d := json.NewDecoder(bytes.NewReader(doc))
+				d.UseNumber()
+				if err := d.Decode(&values[i]); err != nil {
+					return fmt.Errorf("column %q: %w", columns[i], err)
+				}
+			}
+		}
+		for _, f := range fields {
+			v, ok := lookupJSONPath(values[f.column], f.path)
+			if !ok {
+				continue
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(b, f.value.Addr().Interface()); err != nil {
+				return fmt.Errorf("column %q: %w", columns[f.column], err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// parseJSONPath parses a path like $.key[0].name into a list of object keys
+// (strings) and array indexes (ints).
+func parseJSONPath(path string) ([]any, error) {
+	s, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("json path %q does not start with $", path)
+	}
+	var segments []any
+	for s != "" {
+		switch s[0] {
+		case '.':
+			i := strings.IndexAny(s[1:], ".[") + 1
+			if i == 0 {
+				i = len(s)
+			}
+			if i == 1 {
+				return nil, fmt.Errorf("json path %q has an empty key", path)
+			}
+			segments, s = append(segments, s[1:i]), s[i:]
+		case '[':
+			i := strings.IndexByte(s, ']')
+			if i < 0 {
+				return nil, fmt.Errorf("json path %q has an unterminated index", path)
+			}
+			n, err := strconv.Atoi(s[1:i])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("json path %q has an invalid index %q", path, s[1:i])
+			}
+			segments, s = append(segments, n), s[i+1:]
+		default:
+			return nil, fmt.Errorf("json path %q has an invalid segment %q", path, s)
+		}
+	}
+	return segments, nil
+}
+
+// lookupJSONPath returns the value at a path in a decoded json document, and
+// whether it exists.
+func lookupJSONPath(v any, path []any) (any, bool) {
+	for _, segment := range path {
+		switch s := segment.(type) {
+		case string:
+			m, ok := v.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[s]; !ok {
+				return nil, false
+			}
+		case int:
+			a, ok := v.([]any)
+			if !ok || s >= len(a) {
+				return nil, false
+			}
+			v = a[s]
+		}
+	}
+	return v, true
+}
+
+// scanRawBytes changes the scan arguments pointing to []byte and string fields
+// to use [sql.RawBytes], and returns a function to call after scanning each
+// row, which assigns the string fields to the memory referenced by the raw
+// bytes.
+//
+// The function returns nil if there are no string fields.
+func scanRawBytes(scanArgs []any) func() error {
+	var stringIndexes []int
+	var stringFields []*string
+
+	for i, arg := range scanArgs {
+		switch p := arg.(type) {
+		case *[]byte:
+			scanArgs[i] = (*sql.RawBytes)(p)
+		case *string:
+			stringIndexes = append(stringIndexes, i)
+			stringFields = append(stringFields, p)
+		}
+	}
+
+	if len(stringFields) == 0 {
+		return nil
+	}
+
+	rawBytes := make([]sql.RawBytes, len(stringFields))
+	for i, columnIndex := range stringIndexes {
+		scanArgs[columnIndex] = &rawBytes[i]
+	}
+
+	return func() error {
+		for i, b := range rawBytes {
+			*stringFields[i] = unsafe.String(unsafe.SliceData(b), len(b))
+		}
+		return nil
+	}
+}
+
+// scanMaxBytes returns a function to call before scanning each row, which
+// checks the size of the values returned by the driver for the columns, so
+// the limit applies regardless of the destinations that the values are
+// scanned into.
+//
+// The row is scanned a first time into [valueSize] destinations, which only
+// measure the string and []byte values without copying them.
+func scanMaxBytes(rows *sql.Rows, columns []string, limit int) func() error {
+	sizes := make([]valueSize, len(columns))
+	sizeArgs := make([]any, len(columns))
+	for i := range sizes {
+		sizeArgs[i] = &sizes[i]
+	}
+
+	return func() error {
+		if err := rows.Scan(sizeArgs...); err != nil {
+			return err
+		}
+		for i, size := range sizes {
+			if int(size) > limit {
+				return fmt.Errorf("%w: column %q has %d bytes, exceeding the limit of %d bytes", ErrValueTooLarge, columns[i], size, limit)
+			}
+		}
+		return nil
+	}
+}
+
+// valueSize is a [sql.Scanner] recording the size of the string and []byte
+// values returned by the driver, other values have a size of zero.
+type valueSize int
+
+func (n *valueSize) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		*n = valueSize(len(v))
+	case []byte:
+		*n = valueSize(len(v))
+	default:
+		*n = 0
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// IsScannable reports whether values of type Row can be scanned from the rows
+// of a query, which allows generic code building on sqlrange to fail early
+// with a descriptive error instead of when running queries.
+//
+// Struct types are scannable when they have at least one field mapped to a
+// column, and when the tag options of their fields are valid, for example when
+// enum values were registered for the types of fields with the "enum" option.
+// Map types with string keys and scalar or interface values are scannable, see
+// [Scan]. Scalar types scannable by [sql.Rows.Scan] (booleans, numbers, strings,
+// byte slices, time.Time, and types implementing [sql.Scanner]) are also
+// reported as scannable, they can be used as type parameter of [QueryScalar] and
+// [QueryMap].
+//
+// The function returns false and an error explaining why the type cannot be
+// scanned otherwise.
+func IsScannable[Row any]() (bool, error) {
+	t := reflect.TypeOf(new(Row)).Elem()
+
+	if isScalar(t) {
+		return true, nil
+	}
+	if t.Kind() == reflect.Map {
+		if err := checkMapType(t); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if t.Kind() != reflect.Struct {
+		return false, fmt.Errorf("values of type %s cannot be scanned from rows, the type must be a struct, a map, or a scalar", t)
+	}
+
+	fields := cachedFieldsOf(t)
+	if len(fields) == 0 {
+		return false, fmt.Errorf("struct type %s has no fields with a sql tag", t)
+	}
+
+	val := reflect.New(t).Elem()
+	for _, f := range fields {
+		fieldValue := val.FieldByIndex(f.field.Index)
+		if f.options.contains("enum") {
+			if _, err := enumCheck(f.name, fieldValue); err != nil {
+				return false, err
+			}
+		}
+		if f.options.contains("sentinel") {
+			if _, err := sentinelOf(f.name, fieldValue.Type()); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if fieldIndex := extraField(t, nil, defaultTags); fieldIndex != nil {
+		if f := t.FieldByIndex(fieldIndex); f.Type != extraType {
+			return false, fmt.Errorf("field with the extra tag option must be of type %s, got %s", extraType, f.Type)
+		}
+	}
+
+	return true, nil
+}
+
+// checkMapType returns an error if t is not a map type that rows can be
+// scanned into, which requires string keys and values of a scalar or
+// interface type.
+func checkMapType(t reflect.Type) error {
+	if t.Key().Kind() != reflect.String {
+		return fmt.Errorf("values of type %s cannot be scanned from rows, the map keys must be strings", t)
+	}
+	if v := t.Elem(); !isScalar(v) && v.Kind() != reflect.Interface && converterOf(v) == nil {
+		return fmt.Errorf("values of type %s cannot be scanned from rows, the map values must be scalars", t)
+	}
+	return nil
+}
+
+// scanMaps is the implementation of [Scan] for Row types which are maps, each
+// row is scanned into a new map with one entry per column, the values being
+// converted to the value type of the map.
+func scanMaps[Row any](ctx context.Context, yield func(Row, error) bool, rows *sql.Rows, columns []string, options *scanOptions) {
+	var zero Row
+	t := reflect.TypeOf(new(Row)).Elem()
+
+	if err := checkMapType(t); err != nil {
+		yield(zero, err)
+		return
+	}
+
+	keys := make([]reflect.Value, len(columns))
+	values := make([]reflect.Value, len(columns))
+	scanArgs := make([]any, len(columns))
+	for i, column := range columns {
+		keys[i] = reflect.ValueOf(column).Convert(t.Key())
+		values[i] = reflect.New(t.Elem()).Elem()
+		scanArgs[i] = scanDest(values[i])
+	}
+
+	var checkSizes func() error
+	if options.maxBytes > 0 {
+		checkSizes = scanMaxBytes(rows, columns, options.maxBytes)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			yield(zero, err)
+			return
+		}
+		if !rows.Next() {
+			break
+		}
+		if checkSizes != nil {
+			if err := checkSizes(); err != nil {
+				yield(zero, err)
+				return
+			}
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			yield(zero, scanError(rows, columns, scanArgs, make([]reflect.StructField, len(columns)), err))
+			return
+		}
+		m := reflect.MakeMapWithSize(t, len(columns))
+		for i, value := range values {
+			m.SetMapIndex(keys[i], value)
+			value.SetZero()
+		}
+		if !yield(m.Interface().(Row), nil) {
+			return
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		yield(zero, err)
+	}
+}
+
+// isScalar reports whether t is a type that [sql.Rows.Scan] can scan a single
+// column into.
+func isScalar(t reflect.Type) bool {
+	if t == timeType || reflect.PointerTo(t).Implements(scannerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return isNumber(t.Kind())
+}
@@ -0,0 +1,1202 @@
+package sqlrange_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+type Manager struct {
+	ManagerName string `sql:"manager_name"`
+	ManagerAge  int64  `sql:"manager_age"`
+}
+
+func TestScanNullStructs(t *testing.T) {
+	type employee struct {
+		Name string `sql:"name"`
+		*Manager
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"name", "manager_name", "manager_age"},
+			[]driver.Value{"Alice", "Bob", int64(42)},
+			[]driver.Value{"Bob", nil, nil},
+			[]driver.Value{"Chris", "Bob", int64(42)},
+		), nil
+	})
+	defer db.Close()
+
+	var employees []employee
+	for e, err := range sqlrange.Query[employee](db,
+		`SELECT e.name, m.name AS manager_name, m.age AS manager_age FROM employees e LEFT JOIN employees m ON e.manager_id = m.id`,
+		sqlrange.ScanNullStructs(),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		employees = append(employees, e)
+	}
+
+	if len(employees) != 3 {
+		t.Fatalf("expect 3 employees, got %d", len(employees))
+	}
+	for _, i := range []int{0, 2} {
+		if m := employees[i].Manager; m == nil {
+			t.Errorf("%s: expect a manager", employees[i].Name)
+		} else if *m != (Manager{ManagerName: "Bob", ManagerAge: 42}) {
+			t.Errorf("%s: wrong manager: %+v", employees[i].Name, *m)
+		}
+	}
+	if employees[0].Manager == employees[2].Manager {
+		t.Error("rows share the same manager value")
+	}
+	if m := employees[1].Manager; m != nil {
+		t.Errorf("%s: expect no manager, got %+v", employees[1].Name, *m)
+	}
+}
+
+func TestScanNullStructsNamed(t *testing.T) {
+	type employee struct {
+		Name    string `sql:"name"`
+		Manager *Manager
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"name", "manager_name", "manager_age"},
+			[]driver.Value{"Alice", "Bob", int64(42)},
+			[]driver.Value{"Bob", nil, nil},
+		), nil
+	})
+	defer db.Close()
+
+	employees, err := sqlrange.Collect(sqlrange.Query[employee](db,
+		`SELECT e.name, m.name AS manager_name, m.age AS manager_age FROM employees e LEFT JOIN employees m ON e.manager_id = m.id`,
+		sqlrange.ScanNullStructs(),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(employees) != 2 {
+		t.Fatalf("expect 2 employees, got %d", len(employees))
+	}
+	if m := employees[0].Manager; m == nil || *m != (Manager{ManagerName: "Bob", ManagerAge: 42}) {
+		t.Errorf("%s: wrong manager: %+v", employees[0].Name, m)
+	}
+	if m := employees[1].Manager; m != nil {
+		t.Errorf("%s: expect no manager, got %+v", employees[1].Name, *m)
+	}
+}
+
+// Supervisor is embedded by pointer in the rows of TestScanWithTags, it must be
+// exported to be mapped to columns.
+type Supervisor struct {
+	SupervisorName string `db:"supervisor_name"`
+}
+
+func TestScanWithTags(t *testing.T) {
+	type employee struct {
+		Name string `db:"name"`
+		*Supervisor
+		Extra map[string]any `db:",extra"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"name", "supervisor_name", "team"},
+			[]driver.Value{"Alice", "Bob", "red"},
+			[]driver.Value{"Bob", nil, "blue"},
+		), nil
+	})
+	defer db.Close()
+
+	ctx := sqlrange.WithTags(context.Background(), "db")
+	employees, err := sqlrange.Collect(sqlrange.QueryContext[employee](ctx, db, `SELECT * FROM employees`,
+		sqlrange.ScanNullStructs(),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(employees) != 2 {
+		t.Fatalf("expect 2 employees, got %d", len(employees))
+	}
+
+	if s := employees[0].Supervisor; s == nil || s.SupervisorName != "Bob" {
+		t.Errorf("wrong supervisor: %+v", s)
+	}
+	if s := employees[1].Supervisor; s != nil {
+		t.Errorf("expect no supervisor, got %+v", *s)
+	}
+	for i, team := range []string{"red", "blue"} {
+		if extra := employees[i].Extra; len(extra) != 1 || extra["team"] != team {
+			t.Errorf("wrong extra columns: %v", extra)
+		}
+	}
+}
+
+func TestScanBool(t *testing.T) {
+	type flags struct {
+		Active  bool `sql:"active"`
+		Deleted bool `sql:"deleted"`
+		Admin   bool `sql:"admin"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"active", "deleted", "admin"},
+			[]driver.Value{int64(1), []byte{0}, true},
+			[]driver.Value{int64(0), []byte{1}, false},
+			[]driver.Value{int64(1), []byte("1"), "true"},
+		), nil
+	})
+	defer db.Close()
+
+	var results []flags
+	for f, err := range sqlrange.Query[flags](db, `SELECT active, deleted, admin FROM users`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, f)
+	}
+
+	expect := []flags{
+		{Active: true, Deleted: false, Admin: true},
+		{Active: false, Deleted: true, Admin: false},
+		{Active: true, Deleted: true, Admin: true},
+	}
+
+	if !slices.Equal(results, expect) {
+		t.Errorf("expect %v, got %v", expect, results)
+	}
+}
+
+func TestScanBoolInvalid(t *testing.T) {
+	type flags struct {
+		Active bool `sql:"active"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"active"}, []driver.Value{int64(2)}), nil
+	})
+	defer db.Close()
+
+	for _, err := range sqlrange.Query[flags](db, `SELECT active FROM users`) {
+		if err == nil {
+			t.Error("expect an error scanning 2 into a bool")
+		}
+	}
+}
+
+// temperature is an immutable type with unexported fields, which receives its
+// value from the database via a SetSQL method.
+type temperature struct {
+	celsius float64
+	valid   bool
+}
+
+func (t *temperature) SetSQL(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*t = temperature{}
+	case float64:
+		*t = temperature{celsius: v, valid: true}
+	default:
+		return fmt.Errorf("unsupported temperature value: %T", value)
+	}
+	return nil
+}
+
+func (t temperature) Celsius() (float64, bool) { return t.celsius, t.valid }
+
+func TestScanSetters(t *testing.T) {
+	type reading struct {
+		Sensor string      `sql:"sensor"`
+		Temp   temperature `sql:"temp"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"sensor", "temp"},
+			[]driver.Value{"a", 21.5},
+			[]driver.Value{"b", nil},
+		), nil
+	})
+	defer db.Close()
+
+	for _, err := range sqlrange.Query[reading](db, `SELECT sensor, temp FROM readings`) {
+		if err == nil {
+			t.Error("expect an error scanning into a Setter without the option")
+		}
+	}
+
+	var readings []reading
+	for r, err := range sqlrange.Query[reading](db, `SELECT sensor, temp FROM readings`, sqlrange.ScanSetters()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		readings = append(readings, r)
+	}
+
+	if len(readings) != 2 {
+		t.Fatalf("expect 2 readings, got %d", len(readings))
+	}
+	if c, ok := readings[0].Temp.Celsius(); !ok || c != 21.5 {
+		t.Errorf("expect 21.5, got %v (valid=%t)", c, ok)
+	}
+	if _, ok := readings[1].Temp.Celsius(); ok {
+		t.Error("expect an invalid temperature for a NULL column")
+	}
+}
+
+func TestScanExtra(t *testing.T) {
+	type product struct {
+		ID    int64          `sql:"id"`
+		Name  string         `sql:"name"`
+		Extra map[string]any `sql:",extra"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"id", "color", "name", "weight"},
+			[]driver.Value{int64(1), "red", "apple", 0.2},
+			[]driver.Value{int64(2), []byte("yellow"), "banana", nil},
+		), nil
+	})
+	defer db.Close()
+
+	var products []product
+	for p, err := range sqlrange.Query[product](db, `SELECT * FROM products`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		products = append(products, p)
+	}
+
+	if len(products) != 2 {
+		t.Fatalf("expect 2 products, got %d", len(products))
+	}
+
+	p := products[0]
+	if p.ID != 1 || p.Name != "apple" {
+		t.Errorf("wrong known fields: %+v", p)
+	}
+	if len(p.Extra) != 2 || p.Extra["color"] != "red" || p.Extra["weight"] != 0.2 {
+		t.Errorf("wrong extra columns: %v", p.Extra)
+	}
+
+	p = products[1]
+	if p.ID != 2 || p.Name != "banana" {
+		t.Errorf("wrong known fields: %+v", p)
+	}
+	if color, _ := p.Extra["color"].([]byte); string(color) != "yellow" {
+		t.Errorf("wrong color: %v", p.Extra["color"])
+	}
+	if weight, ok := p.Extra["weight"]; !ok || weight != nil {
+		t.Errorf("expect a nil weight, got %v", weight)
+	}
+}
+
+func TestScanUnmappedColumns(t *testing.T) {
+	type product struct {
+		ID   int64  `sql:"id"`
+		Name string `sql:"name"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"id", "color", "name", "weight"},
+			[]driver.Value{int64(1), "red", "apple", 0.2},
+			[]driver.Value{int64(2), []byte("yellow"), "banana", nil},
+		), nil
+	})
+	defer db.Close()
+
+	products, err := sqlrange.Collect(sqlrange.Query[product](db, `SELECT * FROM products`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []product{{1, "apple"}, {2, "banana"}}; !slices.Equal(products, expect) {
+		t.Errorf("expect %v, got %v", expect, products)
+	}
+}
+
+func TestScanRawBytes(t *testing.T) {
+	type document struct {
+		Text string `sql:"meta"`
+	}
+	type blob struct {
+		Data []byte `sql:"meta"`
+	}
+
+	values := []string{`{"a":1}`, `{"b":2}`, `{"c":3}`}
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return &reusedBufferRows{values: values}, nil
+	})
+	defer db.Close()
+
+	i := 0
+	for doc, err := range sqlrange.Query[document](db, `SELECT meta FROM docs`, sqlrange.ScanRawBytes()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Text != values[i] {
+			t.Errorf("expect %q, got %q", values[i], doc.Text)
+		}
+		i++
+	}
+	if i != len(values) {
+		t.Errorf("expect %d rows, got %d", len(values), i)
+	}
+
+	i = 0
+	for b, err := range sqlrange.Query[blob](db, `SELECT meta FROM docs`, sqlrange.ScanRawBytes()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b.Data) != values[i] {
+			t.Errorf("expect %q, got %q", values[i], b.Data)
+		}
+		i++
+	}
+	if i != len(values) {
+		t.Errorf("expect %d rows, got %d", len(values), i)
+	}
+}
+
+func TestScanMaxBytes(t *testing.T) {
+	type file struct {
+		Name string `sql:"name"`
+		Data []byte `sql:"data"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"name", "data"},
+			[]driver.Value{"small", []byte("1234")},
+			[]driver.Value{"empty", nil},
+			[]driver.Value{"large", []byte("123456789")},
+		), nil
+	})
+	defer db.Close()
+	const query = `SELECT name, data FROM files`
+
+	var files []file
+	var err error
+	for f, e := range sqlrange.Query[file](db, query, sqlrange.ScanMaxBytes(8)) {
+		if e != nil {
+			err = e
+			break
+		}
+		files = append(files, f)
+	}
+
+	if !errors.Is(err, sqlrange.ErrValueTooLarge) {
+		t.Fatalf("expect ErrValueTooLarge, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"data"`) {
+		t.Errorf("expect the error to name the column, got %v", err)
+	}
+
+	expect := []file{{Name: "small", Data: []byte("1234")}, {Name: "empty"}}
+	if !slices.EqualFunc(files, expect, func(a, b file) bool {
+		return a.Name == b.Name && string(a.Data) == string(b.Data) && (a.Data == nil) == (b.Data == nil)
+	}) {
+		t.Errorf("expect %q, got %q", expect, files)
+	}
+
+	rows := 0
+	for _, err := range sqlrange.Query[file](db, query, sqlrange.ScanMaxBytes(5), sqlrange.ScanRawBytes()) {
+		if err != nil {
+			if !errors.Is(err, sqlrange.ErrValueTooLarge) || !strings.Contains(err.Error(), `"data"`) {
+				t.Errorf("expect ErrValueTooLarge for the data column, got %v", err)
+			}
+			break
+		}
+		rows++
+	}
+	if rows != 2 {
+		t.Errorf("expect 2 rows before the error, got %d", rows)
+	}
+}
+
+type (
+	blobString string
+	blobBytes  []byte
+)
+
+func TestScanMaxBytesDestinations(t *testing.T) {
+	large := []byte("0123456789abcdef")
+
+	t.Run("json.RawMessage", func(t *testing.T) {
+		testScanMaxBytes[struct {
+			V json.RawMessage `sql:"v"`
+		}](t, large)
+	})
+	t.Run("named string", func(t *testing.T) {
+		testScanMaxBytes[struct {
+			V blobString `sql:"v"`
+		}](t, string(large))
+	})
+	t.Run("named bytes", func(t *testing.T) {
+		testScanMaxBytes[struct {
+			V blobBytes `sql:"v"`
+		}](t, large)
+	})
+	t.Run("sql.NullString", func(t *testing.T) {
+		testScanMaxBytes[struct {
+			V sql.NullString `sql:"v"`
+		}](t, large)
+	})
+	t.Run("converter", func(t *testing.T) {
+		testScanMaxBytes[struct {
+			V geoPoint `sql:"v"`
+		}](t, large)
+	})
+	t.Run("text", func(t *testing.T) {
+		testScanMaxBytes[struct {
+			V net.IP `sql:"v"`
+		}](t, "192.168.100.200")
+	})
+	t.Run("unmapped", func(t *testing.T) {
+		testScanMaxBytes[struct {
+			W int64 `sql:"w"`
+		}](t, large)
+	})
+	t.Run("map", func(t *testing.T) {
+		testScanMaxBytes[map[string]any](t, large)
+	})
+}
+
+func testScanMaxBytes[Row any](t *testing.T, value driver.Value) {
+	t.Helper()
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"v"}, []driver.Value{value}), nil
+	})
+	defer db.Close()
+
+	for _, err := range sqlrange.Query[Row](db, `SELECT v FROM blobs`, sqlrange.ScanMaxBytes(8)) {
+		if !errors.Is(err, sqlrange.ErrValueTooLarge) || !strings.Contains(err.Error(), `"v"`) {
+			t.Errorf("expect ErrValueTooLarge for the v column, got %v", err)
+		}
+		return
+	}
+	t.Error("expect an error for a value exceeding the limit")
+}
+
+func TestScanLooseNumbers(t *testing.T) {
+	type product struct {
+		Quantity int     `sql:"quantity"`
+		Stock    uint8   `sql:"stock"`
+		Price    float64 `sql:"price"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"quantity", "stock", "price"},
+			[]driver.Value{"42.00", []byte(" 7 "), " 9.99"},
+			[]driver.Value{"42", int64(7), "1e2"},
+		), nil
+	})
+	defer db.Close()
+
+	for _, err := range sqlrange.Query[product](db, `SELECT quantity, stock, price FROM products`) {
+		if err == nil {
+			t.Error("expect an error scanning \"42.00\" into an int without the ScanLooseNumbers option")
+		}
+		break
+	}
+
+	var products []product
+	for p, err := range sqlrange.Query[product](db, `SELECT quantity, stock, price FROM products`, sqlrange.ScanLooseNumbers()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		products = append(products, p)
+	}
+
+	expect := []product{
+		{Quantity: 42, Stock: 7, Price: 9.99},
+		{Quantity: 42, Stock: 7, Price: 100},
+	}
+	if !slices.Equal(products, expect) {
+		t.Errorf("expect %v, got %v", expect, products)
+	}
+}
+
+func TestScanLooseNumbersInvalid(t *testing.T) {
+	type product struct {
+		Stock uint8 `sql:"stock"`
+	}
+
+	for _, value := range []driver.Value{"4.2", "256", "-1", "forty-two", nil} {
+		db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"stock"}, []driver.Value{value}), nil
+		})
+		defer db.Close()
+
+		for _, err := range sqlrange.Query[product](db, `SELECT stock FROM products`, sqlrange.ScanLooseNumbers()) {
+			if err == nil {
+				t.Errorf("expect an error scanning %#v into a uint8", value)
+			}
+		}
+	}
+}
+
+func TestScanNumberBase(t *testing.T) {
+	type register struct {
+		Value   int     `sql:"value"`
+		Flags   uint8   `sql:"flags"`
+		Voltage float64 `sql:"voltage"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"value", "flags", "voltage"},
+			[]driver.Value{"0xFF", []byte("ff"), "3.3"},
+			[]driver.Value{"-0x10", " 0X0a ", float64(5)},
+			[]driver.Value{int64(16), "7", "12"},
+		), nil
+	})
+	defer db.Close()
+
+	registers, err := sqlrange.Collect(sqlrange.Query[register](db, `SELECT value, flags, voltage FROM registers`, sqlrange.ScanNumberBase(16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []register{
+		{Value: 255, Flags: 255, Voltage: 3.3},
+		{Value: -16, Flags: 10, Voltage: 5},
+		{Value: 16, Flags: 7, Voltage: 12},
+	}
+	if !slices.Equal(registers, expect) {
+		t.Errorf("expect %v, got %v", expect, registers)
+	}
+
+	for _, value := range []driver.Value{"0x100", "fg", "1.0"} {
+		db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"flags"}, []driver.Value{value}), nil
+		})
+		defer db.Close()
+
+		for _, err := range sqlrange.Query[register](db, `SELECT flags FROM registers`, sqlrange.ScanNumberBase(16)) {
+			if err == nil {
+				t.Errorf("expect an error scanning %#v into a uint8 in base 16", value)
+			}
+		}
+	}
+}
+
+func TestScanPrecisionWarning(t *testing.T) {
+	type balance struct {
+		Amount float64 `sql:"amount"`
+		Rate   float32 `sql:"rate"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"amount", "rate"},
+			[]driver.Value{"12.5", []byte("0.25")},
+			[]driver.Value{"12345678901234567890.123456789", "0.1"},
+			[]driver.Value{int64(1<<53 + 1), 0.1},
+		), nil
+	})
+	defer db.Close()
+
+	var warnings []string
+	warn := func(column, raw string) {
+		warnings = append(warnings, column+"="+raw)
+	}
+
+	balances, err := sqlrange.Collect(sqlrange.Query[balance](db, `SELECT amount, rate FROM balances`, sqlrange.ScanPrecisionWarning(warn)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []balance{
+		{Amount: 12.5, Rate: 0.25},
+		{Amount: 12345678901234567890.123456789, Rate: 0.1},
+		{Amount: 1 << 53, Rate: 0.1},
+	}
+	if !slices.Equal(balances, expect) {
+		t.Errorf("expect %v, got %v", expect, balances)
+	}
+
+	expectWarnings := []string{
+		"amount=12345678901234567890.123456789",
+		"rate=0.1",
+		"amount=9007199254740993",
+	}
+	if !slices.Equal(warnings, expectWarnings) {
+		t.Errorf("expect warnings %q, got %q", expectWarnings, warnings)
+	}
+}
+
+func TestScanFloatToInt(t *testing.T) {
+	type metric struct {
+		Count int    `sql:"count"`
+		Total uint32 `sql:"total"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"count", "total"},
+			[]driver.Value{float64(42), float64(1e6)},
+			[]driver.Value{int64(7), "8"},
+		), nil
+	})
+	defer db.Close()
+
+	for _, err := range sqlrange.Query[metric](db, `SELECT count, total FROM metrics`) {
+		if err == nil {
+			t.Error("expect an error scanning 1e6 into a uint32 without the ScanFloatToInt option")
+		}
+		break
+	}
+
+	var metrics []metric
+	for m, err := range sqlrange.Query[metric](db, `SELECT count, total FROM metrics`, sqlrange.ScanFloatToInt()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics = append(metrics, m)
+	}
+
+	expect := []metric{{Count: 42, Total: 1e6}, {Count: 7, Total: 8}}
+	if !slices.Equal(metrics, expect) {
+		t.Errorf("expect %v, got %v", expect, metrics)
+	}
+}
+
+func TestScanFloatToIntInvalid(t *testing.T) {
+	type metric struct {
+		Count int8 `sql:"count"`
+	}
+
+	for _, value := range []driver.Value{42.5, float64(128), int64(-129), "4.0", nil} {
+		db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"count"}, []driver.Value{value}), nil
+		})
+		defer db.Close()
+
+		for _, err := range sqlrange.Query[metric](db, `SELECT count FROM metrics`, sqlrange.ScanFloatToInt()) {
+			if err == nil {
+				t.Errorf("expect an error scanning %#v into an int8", value)
+			}
+		}
+	}
+}
+
+func TestScanDefaults(t *testing.T) {
+	type user struct {
+		ID     int64  `sql:"id"`
+		Name   string `sql:"name"`
+		Status string `sql:"status"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"id", "name"},
+			[]driver.Value{int64(1), "Alice"},
+			[]driver.Value{int64(2), "Bob"},
+		), nil
+	})
+	defer db.Close()
+
+	var users []user
+	for u, err := range sqlrange.Query[user](db, `SELECT id, name FROM users`,
+		sqlrange.ScanDefaults(map[string]any{"name": "unknown", "status": "active"}),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+
+	expect := []user{
+		{ID: 1, Name: "Alice", Status: "active"},
+		{ID: 2, Name: "Bob", Status: "active"},
+	}
+	if !slices.Equal(users, expect) {
+		t.Errorf("expect %v, got %v", expect, users)
+	}
+
+	for _, defaults := range []map[string]any{{"state": "active"}, {"status": 1}} {
+		for _, err := range sqlrange.Query[user](db, `SELECT id, name FROM users`, sqlrange.ScanDefaults(defaults)) {
+			if err == nil {
+				t.Errorf("expect an error scanning with defaults %v", defaults)
+			}
+		}
+	}
+}
+
+func TestScanCoalesce(t *testing.T) {
+	type user struct {
+		ID     int64          `sql:"id"`
+		Name   string         `sql:"name"`
+		Status string         `sql:"status"`
+		Score  *int64         `sql:"score"`
+		Email  sql.NullString `sql:"email"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"id", "name", "status", "score", "email"},
+			[]driver.Value{int64(1), "Alice", nil, nil, nil},
+			[]driver.Value{int64(2), "Bob", "banned", int64(3), "bob@example.com"},
+		), nil
+	})
+	defer db.Close()
+	const query = `SELECT id, name, status, score, email FROM users`
+
+	for _, err := range sqlrange.Query[user](db, query) {
+		if err == nil {
+			t.Error("expect an error scanning NULL into a string without the ScanCoalesce option")
+		}
+		break
+	}
+
+	zero := int64(0)
+	noEmail := sql.NullString{String: "none", Valid: true}
+	users, err := sqlrange.Collect(sqlrange.Query[user](db, query,
+		sqlrange.ScanCoalesce(map[string]any{"status": "active", "score": &zero, "email": noEmail}),
+		sqlrange.ScanDefaults(map[string]any{"status": "unused"}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expect 2 users, got %d", len(users))
+	}
+
+	if u := users[0]; u.Name != "Alice" || u.Status != "active" || u.Score != &zero || u.Email != noEmail {
+		t.Errorf("wrong first user: %+v", u)
+	}
+	if u := users[1]; u.Name != "Bob" || u.Status != "banned" || u.Score == nil || *u.Score != 3 || u.Email.String != "bob@example.com" {
+		t.Errorf("wrong second user: %+v", u)
+	}
+
+	for _, defaults := range []map[string]any{{"state": "active"}, {"status": 1}} {
+		for _, err := range sqlrange.Query[user](db, query, sqlrange.ScanCoalesce(defaults)) {
+			if err == nil {
+				t.Errorf("expect an error scanning with defaults %v", defaults)
+			}
+		}
+	}
+}
+
+func TestScanJSONPath(t *testing.T) {
+	type event struct {
+		ID    int64           `sql:"id"`
+		Name  string          `sql:"doc,jsonpath=$.user.name"`
+		City  string          `sql:"doc,jsonpath=$.user.addresses[1].city"`
+		Count int             `sql:"doc,jsonpath=$.count"`
+		Tag   string          `sql:"doc,jsonpath=$.tags[2]"`
+		Doc   json.RawMessage `sql:"doc"`
+	}
+
+	doc := `{"user":{"name":"Alice","addresses":[{"city":"Paris"},{"city":"Lyon"}]},"count":3,"tags":["a"]}`
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"id", "doc"},
+			[]driver.Value{int64(1), []byte(doc)},
+			[]driver.Value{int64(2), nil},
+		), nil
+	})
+	defer db.Close()
+
+	var events []event
+	for e, err := range sqlrange.Query[event](db, `SELECT id, doc FROM events`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+
+	expect := []event{
+		{ID: 1, Name: "Alice", City: "Lyon", Count: 3, Doc: json.RawMessage(doc)},
+		{ID: 2},
+	}
+	if !reflect.DeepEqual(events, expect) {
+		t.Errorf("expect %+v, got %+v", expect, events)
+	}
+
+	for _, err := range sqlrange.Query[struct {
+		Name string `sql:"doc,jsonpath=user.name"`
+	}](db, `SELECT id, doc FROM events`) {
+		if err == nil {
+			t.Error("expect an error for a json path not starting with $")
+		}
+	}
+}
+
+// multiResultRows is a driver.Rows yielding multiple result sets, which counts
+// the number of times it was closed.
+type multiResultRows struct {
+	sets   []*stubRows
+	index  int
+	closed int
+}
+
+func (r *multiResultRows) Columns() []string { return r.sets[r.index].Columns() }
+
+func (r *multiResultRows) Close() error {
+	r.closed++
+	return nil
+}
+
+func (r *multiResultRows) Next(dest []driver.Value) error { return r.sets[r.index].Next(dest) }
+
+func (r *multiResultRows) HasNextResultSet() bool { return r.index+1 < len(r.sets) }
+
+func (r *multiResultRows) NextResultSet() error {
+	if !r.HasNextResultSet() {
+		return io.EOF
+	}
+	r.index++
+	return nil
+}
+
+func TestScanNoClose(t *testing.T) {
+	type user struct {
+		Name string `sql:"name"`
+	}
+	type order struct {
+		Item string `sql:"item"`
+	}
+
+	driverRows := &multiResultRows{
+		sets: []*stubRows{
+			newStubRows([]string{"name"}, []driver.Value{"Alice"}, []driver.Value{"Bob"}),
+			newStubRows([]string{"item"}, []driver.Value{"apple"}),
+		},
+	}
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return driverRows, nil
+	})
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT name FROM users; SELECT item FROM orders`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var users []user
+	for u, err := range sqlrange.Scan[user](rows, sqlrange.ScanNoClose()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	if expect := []user{{"Alice"}, {"Bob"}}; !slices.Equal(users, expect) {
+		t.Errorf("expect %v, got %v", expect, users)
+	}
+	if driverRows.closed != 0 {
+		t.Fatalf("rows closed %d times after scanning with the ScanNoClose option", driverRows.closed)
+	}
+
+	if !rows.NextResultSet() {
+		t.Fatalf("expect a second result set: %v", rows.Err())
+	}
+
+	var orders []order
+	for o, err := range sqlrange.Scan[order](rows) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders = append(orders, o)
+	}
+	if expect := []order{{"apple"}}; !slices.Equal(orders, expect) {
+		t.Errorf("expect %v, got %v", expect, orders)
+	}
+	if driverRows.closed != 1 {
+		t.Errorf("expect rows to be closed once, got %d", driverRows.closed)
+	}
+}
+
+func TestScanOnlyFields(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	var people []person
+	for p, err := range sqlrange.Query[person](db, `SELECT|people|age,name,bdate,photo|`, sqlrange.ScanOnlyFields("name")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		people = append(people, p)
+	}
+
+	expect := []person{{Name: "Alice"}, {Name: "Bob"}, {Name: "Chris"}}
+	if !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+
+	for _, err := range sqlrange.Query[person](db, `SELECT|people|age,name|`, sqlrange.ScanOnlyFields("name", "photo")) {
+		if err == nil {
+			t.Error("expect an error for a column which is not mapped to any field")
+		}
+	}
+}
+
+func TestScanCombine(t *testing.T) {
+	type user struct {
+		ID       int64  `sql:"id"`
+		First    string `sql:"first_name"`
+		FullName string `sql:"full_name"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"id", "first_name", "last_name"},
+			[]driver.Value{int64(1), "Alice", "Smith"},
+			[]driver.Value{int64(2), "Bob", []byte("Jones")},
+		), nil
+	})
+	defer db.Close()
+
+	fullName := sqlrange.ScanCombine("full_name", []string{"first_name", "last_name"},
+		func(values []any) any {
+			return fmt.Sprintf("%s %s", values[0], values[1])
+		},
+	)
+
+	var users []user
+	for u, err := range sqlrange.Query[user](db, `SELECT id, first_name, last_name FROM users`, fullName) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+
+	expect := []user{
+		{ID: 1, First: "Alice", FullName: "Alice Smith"},
+		{ID: 2, First: "Bob", FullName: "Bob Jones"},
+	}
+	if !slices.Equal(users, expect) {
+		t.Errorf("expect %v, got %v", expect, users)
+	}
+
+	invalid := []sqlrange.ScanOption{
+		sqlrange.ScanCombine("name", []string{"first_name"}, func(values []any) any { return values[0] }),
+		sqlrange.ScanCombine("full_name", []string{"middle_name"}, func(values []any) any { return values[0] }),
+		sqlrange.ScanCombine("full_name", []string{"id"}, func(values []any) any { return values[0] }),
+	}
+	for _, opt := range invalid {
+		for _, err := range sqlrange.Query[user](db, `SELECT id, first_name, last_name FROM users`, opt) {
+			if err == nil {
+				t.Error("expect an error for an invalid combination")
+			}
+			break
+		}
+	}
+}
+
+func TestIsScannable(t *testing.T) {
+	if ok, err := sqlrange.IsScannable[person](); !ok || err != nil {
+		t.Errorf("expect person to be scannable, got %t: %v", ok, err)
+	}
+	if ok, err := sqlrange.IsScannable[int64](); !ok || err != nil {
+		t.Errorf("expect int64 to be scannable, got %t: %v", ok, err)
+	}
+	if ok, err := sqlrange.IsScannable[map[string]any](); !ok || err != nil {
+		t.Errorf("expect map[string]any to be scannable, got %t: %v", ok, err)
+	}
+
+	type untagged struct {
+		Name string
+		Age  int
+	}
+	type unregistered struct {
+		Name *string `sql:"name,sentinel"`
+	}
+
+	for _, scannable := range []func() (bool, error){
+		sqlrange.IsScannable[untagged],
+		sqlrange.IsScannable[unregistered],
+		sqlrange.IsScannable[map[int]string],
+		sqlrange.IsScannable[map[string][]int],
+		sqlrange.IsScannable[[]any],
+	} {
+		if ok, err := scannable(); ok || err == nil {
+			t.Errorf("expect an error, got %t: %v", ok, err)
+		}
+	}
+}
+
+func TestScanTimeLocation(t *testing.T) {
+	type event struct {
+		At      time.Time  `sql:"at"`
+		Updated *time.Time `sql:"updated"`
+		Deleted *time.Time `sql:"deleted"`
+	}
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("UTC+2", 2*3600))
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"at", "updated", "deleted"},
+			[]driver.Value{at, at.UTC(), nil},
+		), nil
+	})
+	defer db.Close()
+
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	for e, err := range sqlrange.Query[event](db, `SELECT at, updated, deleted FROM events`, sqlrange.ScanTimeLocation(loc)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.At.Location() != loc {
+			t.Errorf("expect location %v, got %v", loc, e.At.Location())
+		}
+		if !e.At.Equal(at) {
+			t.Errorf("expect %v, got %v", at, e.At)
+		}
+		if e.Updated == nil || e.Updated.Location() != loc || !e.Updated.Equal(at) {
+			t.Errorf("wrong updated time: %v", e.Updated)
+		}
+		if e.Deleted != nil {
+			t.Errorf("expect no deleted time, got %v", e.Deleted)
+		}
+	}
+}
+
+func TestScanTimeLayout(t *testing.T) {
+	type event struct {
+		At      time.Time  `sql:"at"`
+		Updated *time.Time `sql:"updated"`
+		Deleted *time.Time `sql:"deleted"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"at", "updated", "deleted"},
+			[]driver.Value{"2024-01-02 03:04:05", []byte("2024-01-02 04:04:05"), nil},
+		), nil
+	})
+	defer db.Close()
+	const query = `SELECT at, updated, deleted FROM events`
+
+	for _, err := range sqlrange.Query[event](db, query) {
+		if err == nil {
+			t.Error("expect an error scanning a string into a time.Time without a layout")
+		}
+	}
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	check := func(events []event, loc *time.Location) {
+		t.Helper()
+		if len(events) != 1 {
+			t.Fatalf("expect 1 event, got %d", len(events))
+		}
+		e := events[0]
+		if !e.At.Equal(at) || e.At.Location() != loc {
+			t.Errorf("wrong time: %v", e.At)
+		}
+		if e.Updated == nil || !e.Updated.Equal(at.Add(time.Hour)) || e.Updated.Location() != loc {
+			t.Errorf("wrong updated time: %v", e.Updated)
+		}
+		if e.Deleted != nil {
+			t.Errorf("expect no deleted time, got %v", e.Deleted)
+		}
+	}
+
+	events, err := sqlrange.Collect(sqlrange.Query[event](db, query, sqlrange.ScanTimeLayout(time.DateTime)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(events, time.UTC)
+
+	t.Cleanup(func() {
+		sqlrange.SetDefaultTimeLayout("")
+		sqlrange.SetDefaultTimeLocation(nil)
+	})
+	sqlrange.SetDefaultTimeLayout(time.DateTime)
+
+	events, err = sqlrange.Collect(sqlrange.Query[event](db, query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(events, time.UTC)
+
+	for _, err := range sqlrange.Query[event](db, query, sqlrange.ScanTimeLayout(time.RFC3339)) {
+		if err == nil {
+			t.Error("expect the layout of the option to override the default layout")
+		}
+	}
+
+	loc := time.FixedZone("UTC+2", 2*3600)
+	sqlrange.SetDefaultTimeLocation(loc)
+	at = time.Date(2024, 1, 2, 3, 4, 5, 0, loc)
+
+	events, err = sqlrange.Collect(sqlrange.Query[event](db, query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(events, loc)
+}
+
+func TestScanTrimColumns(t *testing.T) {
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"\uFEFFage", " name "}, []driver.Value{int64(1), "Alice"}), nil
+	})
+	defer db.Close()
+
+	// Without the option the columns are not mapped to any field, so their
+	// values are discarded.
+	for p, err := range sqlrange.Query[person](db, `SELECT age, name FROM people`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != (person{}) {
+			t.Errorf("expect the columns to be discarded without the ScanTrimColumns option, got %v", p)
+		}
+	}
+
+	var people []person
+	for p, err := range sqlrange.Query[person](db, `SELECT age, name FROM people`, sqlrange.ScanTrimColumns()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		people = append(people, p)
+	}
+	if expect := []person{{Age: 1, Name: "Alice"}}; !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+}
+
+func TestScanResultSetsColumnsChanged(t *testing.T) {
+	driverRows := &multiResultRows{
+		sets: []*stubRows{
+			newStubRows([]string{"age", "name"}, []driver.Value{int64(1), "Alice"}),
+			newStubRows([]string{"name", "bdate", "age"}, []driver.Value{"Bob", chrisBirthday, int64(2)}),
+		},
+	}
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return driverRows, nil
+	})
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT age, name FROM people; SELECT name, bdate, age FROM people`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var people []person
+	for i := 0; i < 2; i++ {
+		if i > 0 && !rows.NextResultSet() {
+			t.Fatalf("expect a second result set: %v", rows.Err())
+		}
+		for p, err := range sqlrange.Scan[person](rows, sqlrange.ScanNoClose()) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			people = append(people, p)
+		}
+	}
+
+	expect := []person{{Age: 1, Name: "Alice"}, {Age: 2, Name: "Bob", BirthDate: chrisBirthday}}
+	if !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+}
@@ -0,0 +1,83 @@
+package sqlrange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// ValidateSchema verifies that every field of Row with a "sql" tag is mapped to
+// a column of the table, which allows programs to detect mismatches between
+// their types and the database schema at startup rather than when serving
+// traffic:
+//
+//	if err := sqlrange.ValidateSchema[User](ctx, db, "users"); err != nil {
+//	  log.Fatal(err)
+//	}
+//
+// The columns of the table are read by executing SELECT * FROM table LIMIT 0,
+// the table name is embedded in the query as is and must therefore be a trusted
+// value, quoted by the caller if needed; [ValidateSchemaDialect] quotes it
+// according to a dialect instead. The fields are resolved and the query is
+// executed with the context hooks, as done by [QueryContext]. Columns of the
+// table which are not mapped to any field are allowed.
+//
+// The returned error lists all the fields that have no matching column.
+func ValidateSchema[Row any](ctx context.Context, q Queryable, table string) error {
+	return ValidateSchemaDialect[Row](ctx, q, Dialect{}, table)
+}
+
+// ValidateSchemaDialect is like [ValidateSchema] but it quotes the table name
+// according to the dialect, for example:
+//
+//	err := sqlrange.ValidateSchemaDialect[User](ctx, db, sqlrange.Postgres, "users")
+func ValidateSchemaDialect[Row any](ctx context.Context, q Queryable, dialect Dialect, table string) error {
+	t := reflect.TypeOf(new(Row)).Elem()
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot validate the schema of values of type %s", t)
+	}
+
+	hooks := hooksFrom(ctx)
+	err := validateSchema(ctx, &hooks, q, t, dialect, table)
+	if err != nil {
+		hooks.incErrors()
+	}
+	return err
+}
+
+func validateSchema(ctx context.Context, hooks *hooks, q Queryable, t reflect.Type, dialect Dialect, table string) error {
+	query, err := hooks.query(ctx, "SELECT * FROM "+dialect.quoteTable(table)+" LIMIT 0")
+	if err != nil {
+		return err
+	}
+	if err := hooks.validate(query, nil); err != nil {
+		return err
+	}
+
+	hooks.incQueries()
+	start := hooks.start()
+	rows, err := q.QueryContext(ctx, query)
+	hooks.observe(query, start, err)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, f := range hooks.fields(t) {
+		if !slices.Contains(columns, f.name) {
+			errs = append(errs, fmt.Errorf("table %s has no column %q mapped to field %s of %s", table, f.name, f.field.Name, t))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return rows.Close()
+}
@@ -0,0 +1,83 @@
+package sqlrange_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+func TestValidateSchema(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	// The fake driver does not support SELECT *, the query is rewritten to
+	// list all the columns of the people table.
+	ctx := sqlrange.WithQueryRewriter(context.Background(),
+		func(ctx context.Context, query string) (string, error) {
+			if query != `SELECT * FROM people LIMIT 0` && query != `SELECT * FROM "people" LIMIT 0` {
+				t.Errorf("unexpected query: %s", query)
+			}
+			return `SELECT|people|name,age,photo,dead,bdate|`, nil
+		},
+	)
+
+	if err := sqlrange.ValidateSchema[person](ctx, db, "people"); err != nil {
+		t.Error(err)
+	}
+
+	type alien struct {
+		Name   string `sql:"name"`
+		Planet string `sql:"planet"`
+		Moons  int    `sql:"moons"`
+	}
+
+	err := sqlrange.ValidateSchema[alien](ctx, db, "people")
+	if err == nil {
+		t.Fatal("expect an error for fields without matching columns")
+	}
+	for _, column := range []string{`"planet"`, `"moons"`} {
+		if !strings.Contains(err.Error(), column) {
+			t.Errorf("error does not mention the column %s: %v", column, err)
+		}
+	}
+	if strings.Contains(err.Error(), `"name"`) {
+		t.Errorf("error mentions a column which exists: %v", err)
+	}
+
+	// The fields are resolved with the tags installed on the context.
+	type human struct {
+		Name string `db:"name"`
+		Age  int    `db:"age"`
+	}
+	if err := sqlrange.ValidateSchema[human](sqlrange.WithTags(ctx, "db"), db, "people"); err != nil {
+		t.Error(err)
+	}
+
+	metrics := new(counters)
+	type robot struct {
+		Model string `db:"model"`
+	}
+	if err := sqlrange.ValidateSchema[robot](sqlrange.WithMetrics(sqlrange.WithTags(ctx, "db"), metrics), db, "people"); err == nil {
+		t.Error("expect an error for a field tagged with db without matching column")
+	}
+	if q, e := metrics.queries.Load(), metrics.errors.Load(); q != 1 || e != 1 {
+		t.Errorf("expect 1 query and 1 error, got %d and %d", q, e)
+	}
+
+	var queries []string
+	quoted := sqlrange.WithQueryRewriter(context.Background(),
+		func(ctx context.Context, query string) (string, error) {
+			queries = append(queries, query)
+			return `SELECT|people|name,age,photo,dead,bdate|`, nil
+		},
+	)
+	if err := sqlrange.ValidateSchemaDialect[person](quoted, db, sqlrange.Postgres, "public.people"); err != nil {
+		t.Error(err)
+	}
+	if expect := []string{`SELECT * FROM "public"."people" LIMIT 0`}; !slices.Equal(queries, expect) {
+		t.Errorf("expect %q, got %q", expect, queries)
+	}
+}
@@ -0,0 +1,106 @@
+package sqlrange
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// RegisterNullSentinel registers the value representing NULL for the type T in
+// databases which use sentinel values instead of SQL NULL, such as -1 or an
+// empty string.
+//
+// Struct fields of type *T that have the "sentinel" tag option are converted to
+// and from the sentinel value: a nil pointer is passed as the sentinel value to
+// the queries executed by [Exec] and [ExecContext], and columns containing the
+// sentinel value (or NULL) are scanned as nil pointers. For example:
+//
+//	func init() {
+//	  sqlrange.RegisterNullSentinel[int64](-1)
+//	}
+//
+//	type Row struct {
+//	  ParentID *int64 `sql:"parent_id,sentinel"`
+//	}
+//
+// Calling RegisterNullSentinel multiple times for the same type replaces the
+// sentinel value.
+func RegisterNullSentinel[T comparable](value T) {
+	t := reflect.TypeOf(new(T)).Elem()
+
+	sentinelsMutex.Lock()
+	defer sentinelsMutex.Unlock()
+
+	cache, _ := sentinels.Load().(map[reflect.Type]nullSentinel)
+	newCache := make(map[reflect.Type]nullSentinel, len(cache)+1)
+	for k, v := range cache {
+		newCache[k] = v
+	}
+	newCache[t] = sentinel[T]{value}
+	sentinels.Store(newCache)
+}
+
+var (
+	sentinels      atomic.Value // map[reflect.Type]nullSentinel
+	sentinelsMutex sync.Mutex
+)
+
+// nullSentinel converts the values of struct fields with the "sentinel" tag
+// option, it is implemented by the generic sentinel type so the conversions
+// can be done without reflection on the element type.
+type nullSentinel interface {
+	// arg returns the query argument for a field of type *T.
+	arg(fieldValue reflect.Value) any
+	// dest returns the scan destination for a field of type *T.
+	dest(fieldValue reflect.Value) any
+}
+
+type sentinel[T comparable] struct{ value T }
+
+func (s sentinel[T]) arg(fieldValue reflect.Value) any {
+	if p := fieldValue.Interface().(*T); p != nil {
+		return *p
+	}
+	return s.value
+}
+
+func (s sentinel[T]) dest(fieldValue reflect.Value) any {
+	return &sentinelDest[T]{ptr: fieldValue.Addr().Interface().(**T), sentinel: s.value}
+}
+
+// sentinelDest is a [sql.Scanner] setting a pointer field to nil when the column
+// contains the sentinel value.
+type sentinelDest[T comparable] struct {
+	ptr      **T
+	sentinel T
+	null     sql.Null[T]
+}
+
+func (d *sentinelDest[T]) Scan(src any) error {
+	if err := d.null.Scan(src); err != nil {
+		return err
+	}
+	if !d.null.Valid || d.null.V == d.sentinel {
+		*d.ptr = nil
+	} else {
+		v := d.null.V
+		*d.ptr = &v
+	}
+	return nil
+}
+
+// sentinelOf returns the sentinel registered for the type of a struct field with
+// the "sentinel" tag option.
+func sentinelOf(column string, t reflect.Type) (nullSentinel, error) {
+	if t.Kind() != reflect.Pointer {
+		return nil, fmt.Errorf("column %q: field with the sentinel tag option must be a pointer, got %s", column, t)
+	}
+	cache, _ := sentinels.Load().(map[reflect.Type]nullSentinel)
+	s, ok := cache[t.Elem()]
+	if !ok {
+		return nil, fmt.Errorf("column %q: no null sentinel registered for type %s", column, t.Elem())
+	}
+	return s, nil
+}
@@ -0,0 +1,119 @@
+package sqlrange_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"slices"
+	"testing"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+type legacyID int64
+
+func init() {
+	sqlrange.RegisterNullSentinel[legacyID](-1)
+}
+
+type category struct {
+	ID       legacyID  `sql:"id"`
+	ParentID *legacyID `sql:"parent_id,sentinel"`
+}
+
+func TestNullSentinel(t *testing.T) {
+	var execArgs [][]driver.Value
+	db := sql.OpenDB(&stubConnector{
+		query: func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"id", "parent_id"},
+				[]driver.Value{int64(1), int64(-1)},
+				[]driver.Value{int64(2), int64(1)},
+				[]driver.Value{int64(3), nil},
+			), nil
+		},
+		exec: func(_ string, args []driver.NamedValue) (driver.Result, error) {
+			values := make([]driver.Value, len(args))
+			for i, arg := range args {
+				values[i] = arg.Value
+			}
+			execArgs = append(execArgs, values)
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+
+	parentID := legacyID(1)
+	for _, err := range sqlrange.Exec(db, `INSERT INTO categories (id, parent_id) VALUES (?, ?)`,
+		func(yield func(category, error) bool) {
+			_ = yield(category{ID: 1}, nil) &&
+				yield(category{ID: 2, ParentID: &parentID}, nil)
+		},
+		sqlrange.ExecArgsFields[category]("id", "parent_id"),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, err := range sqlrange.Exec(db, `INSERT INTO categories (id, parent_id) VALUES (?, ?)`,
+		func(yield func(category, error) bool) {
+			yield(category{ID: 3}, nil)
+		},
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectArgs := [][]driver.Value{
+		{int64(1), int64(-1)},
+		{int64(2), int64(1)},
+		{int64(3), int64(-1)},
+	}
+	if !slices.EqualFunc(execArgs, expectArgs, slices.Equal) {
+		t.Errorf("expect %v, got %v", expectArgs, execArgs)
+	}
+
+	var categories []category
+	for c, err := range sqlrange.Query[category](db, `SELECT id, parent_id FROM categories`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		categories = append(categories, c)
+	}
+
+	if len(categories) != 3 {
+		t.Fatalf("expect 3 categories, got %d", len(categories))
+	}
+	if p := categories[0].ParentID; p != nil {
+		t.Errorf("expect the sentinel to be scanned as nil, got %d", *p)
+	}
+	if p := categories[1].ParentID; p == nil || *p != 1 {
+		t.Errorf("expect parent 1, got %v", p)
+	}
+	if p := categories[2].ParentID; p != nil {
+		t.Errorf("expect NULL to be scanned as nil, got %d", *p)
+	}
+}
+
+func TestNullSentinelNotRegistered(t *testing.T) {
+	type row struct {
+		Name *string `sql:"name,sentinel"`
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"name"}, []driver.Value{""}), nil
+	})
+	defer db.Close()
+
+	for _, err := range sqlrange.Query[row](db, `SELECT name FROM names`) {
+		if err == nil {
+			t.Error("expect an error for a type without a registered sentinel")
+		}
+	}
+	for _, err := range sqlrange.Exec(db, `INSERT INTO names (name) VALUES (?)`, func(yield func(row, error) bool) {
+		yield(row{}, nil)
+	}) {
+		if err == nil {
+			t.Error("expect an error for a type without a registered sentinel")
+		}
+	}
+}
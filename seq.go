@@ -0,0 +1,247 @@
+package sqlrange
+
+import (
+	"encoding/gob"
+	"io"
+	"iter"
+)
+
+// Reduce folds the rows of a sequence into an accumulated value, for example to
+// compute aggregations in Go:
+//
+//	total, err := sqlrange.Reduce(sqlrange.Query[Order](db, query), 0,
+//	  func(total int64, order Order) int64 {
+//	    return total + order.Amount
+//	  },
+//	)
+//
+// The iteration stops at the first error yielded by the sequence, in which case
+// the function returns the value accumulated so far along with the error.
+func Reduce[Row, Acc any](seq iter.Seq2[Row, error], init Acc, fn func(Acc, Row) Acc) (Acc, error) {
+	acc := init
+	for row, err := range seq {
+		if err != nil {
+			return acc, err
+		}
+		acc = fn(acc, row)
+	}
+	return acc, nil
+}
+
+// Collect gathers the rows of a sequence in a slice, for example:
+//
+//	people, err := sqlrange.Collect(sqlrange.Query[Person](db, query))
+//
+// The iteration stops at the first error yielded by the sequence, in which case
+// the rows collected so far are discarded and the function returns a nil slice.
+func Collect[Row any](seq iter.Seq2[Row, error]) ([]Row, error) {
+	return CollectN(seq, 0)
+}
+
+// CollectN is like [Collect] but it preallocates the slice with the given
+// capacity, which avoids growing the slice repeatedly when the program knows
+// the approximate number of rows in advance, for example from the LIMIT clause
+// of the query. The slice still grows when the sequence produces more rows.
+//
+// Note that database/sql does not expose the number of rows of a result set,
+// so the function cannot determine the capacity from the driver.
+func CollectN[Row any](seq iter.Seq2[Row, error], capacity int) ([]Row, error) {
+	rows := make([]Row, 0, capacity)
+	for row, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// GroupBy partitions the rows of a sequence by the key returned by fn, for
+// example to gather order lines by order ID:
+//
+//	lines, err := sqlrange.GroupBy(sqlrange.Query[OrderLine](db, query),
+//	  func(line OrderLine) int64 {
+//	    return line.OrderID
+//	  },
+//	)
+//
+// Rows within each group retain the order in which the sequence produced them.
+// The iteration stops at the first error yielded by the sequence, in which case
+// the partial groups are discarded and the function returns a nil map.
+func GroupBy[Row any, Key comparable](seq iter.Seq2[Row, error], key func(Row) Key) (map[Key][]Row, error) {
+	groups := make(map[Key][]Row)
+	for row, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		k := key(row)
+		groups[k] = append(groups[k], row)
+	}
+	return groups, nil
+}
+
+// Tee returns a sequence producing the same elements as seq, and calling fn with
+// each of them before they are passed to the consumer. This allows observing the
+// rows of a sequence, for example to log them, without consuming it:
+//
+//	for row, err := range sqlrange.Tee(sqlrange.Query[Row](db, query),
+//	  func(row Row, err error) {
+//	    log.Println(row, err)
+//	  },
+//	) {
+//	  ...
+//	}
+//
+// The function fn is also called with the errors of the sequence, and it is not
+// called with elements that the sequence did not produce because the consumer
+// stopped the iteration early.
+func Tee[Row any](seq iter.Seq2[Row, error], fn func(Row, error)) iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		for row, err := range seq {
+			fn(row, err)
+			if !yield(row, err) {
+				return
+			}
+		}
+	}
+}
+
+// Map returns a sequence producing the result of calling fn with each row of
+// seq, for example to convert rows read from a database to another type:
+//
+//	for user, err := range sqlrange.Map(sqlrange.Query[UserRow](db, query), UserRow.ToUser) {
+//	  ...
+//	}
+//
+// The errors of the sequence are passed through without calling fn. When fn
+// returns an error, the error is yielded and the iteration stops.
+func Map[In, Out any](seq iter.Seq2[In, error], fn func(In) (Out, error)) iter.Seq2[Out, error] {
+	return func(yield func(Out, error) bool) {
+		var zero Out
+		for in, err := range seq {
+			if err != nil {
+				if !yield(zero, err) {
+					return
+				}
+				continue
+			}
+			out, err := fn(in)
+			if !yield(out, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Seq2FromSeq adapts a sequence of rows without errors to the form accepted by
+// the functions of this package, each row being paired with a nil error. This
+// allows sequences produced by other packages to be passed to [Exec] and
+// [ExecContext], for example to insert the values of a slice:
+//
+//	for r, err := range sqlrange.ExecContext(ctx, tx, query,
+//	  sqlrange.Seq2FromSeq(slices.Values(rows)),
+//	) {
+//	  ...
+//	}
+func Seq2FromSeq[Row any](seq iter.Seq[Row]) iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		for row := range seq {
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ChunkByParams groups the rows of a sequence in batches whose total number of
+// query parameters does not exceed maxParams, as reported by the params
+// function for each row. This is useful to build multi-row statements with
+// [ExecContext] when the rows have a variable number of arguments, without
+// exceeding the limit of the database on the number of parameters of a query,
+// for example:
+//
+//	batches := sqlrange.ChunkByParams(rows, 65535, func(r Row) int {
+//	  return len(columns(r))
+//	})
+//	for r, err := range sqlrange.ExecContext(ctx, tx, query, batches,
+//	  ...
+//	) {
+//	  ...
+//	}
+//
+// Each batch is a new slice, which the program may retain. A row which has more
+// parameters than maxParams on its own is yielded in a batch of its own. When
+// the sequence yields an error, the pending batch is yielded first, followed by
+// the error, which ends the iteration.
+func ChunkByParams[Row any](seq iter.Seq2[Row, error], maxParams int, params func(Row) int) iter.Seq2[[]Row, error] {
+	return func(yield func([]Row, error) bool) {
+		var batch []Row
+		var total int
+
+		for row, err := range seq {
+			if err != nil {
+				if len(batch) > 0 && !yield(batch, nil) {
+					return
+				}
+				yield(nil, err)
+				return
+			}
+			n := params(row)
+			if len(batch) > 0 && total+n > maxParams {
+				if !yield(batch, nil) {
+					return
+				}
+				batch, total = nil, 0
+			}
+			batch = append(batch, row)
+			total += n
+		}
+
+		if len(batch) > 0 {
+			yield(batch, nil)
+		}
+	}
+}
+
+// Drain consumes a sequence and discards its elements, which is useful when the
+// program only needs to know whether the operations succeeded, for example:
+//
+//	if err := sqlrange.Drain(sqlrange.ExecContext(ctx, tx, query, rows)); err != nil {
+//	  ...
+//	}
+//
+// The iteration stops at the first error yielded by the sequence, which is
+// returned by the function.
+func Drain[T any](seq iter.Seq2[T, error]) error {
+	for _, err := range seq {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteGob encodes the rows of a sequence to w as a stream of gob values, which
+// is useful to transfer the results of queries between processes, for example:
+//
+//	err := sqlrange.WriteGob(w, sqlrange.Query[Row](db, query))
+//
+// The rows are encoded with a single [gob.Encoder], so the stream must be read
+// by a single [gob.Decoder], each call to Decode returning one row until it
+// returns [io.EOF]. The rows are encoded as they are produced by the sequence,
+// without being held in memory.
+//
+// The iteration stops at the first error yielded by the sequence or returned by
+// the encoder, which is returned by the function.
+func WriteGob[Row any](w io.Writer, seq iter.Seq2[Row, error]) error {
+	enc := gob.NewEncoder(w)
+	for row, err := range seq {
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
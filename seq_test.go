@@ -0,0 +1,402 @@
+package sqlrange_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/achille-roussel/sqlrange"
+)
+
+func TestReduce(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	sum := func(total int, p person) int { return total + p.Age }
+
+	total, err := sqlrange.Reduce(sqlrange.Query[person](db, `SELECT|people|age,name|`), 0, sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 6 {
+		t.Errorf("expect 6, got %d", total)
+	}
+
+	errBroken := errors.New("broken")
+	calls := 0
+	total, err = sqlrange.Reduce(func(yield func(person, error) bool) {
+		_ = yield(person{Age: 1}, nil) &&
+			yield(person{}, errBroken) &&
+			yield(person{Age: 2}, nil)
+	}, 0, func(total int, p person) int {
+		calls++
+		return sum(total, p)
+	})
+	if !errors.Is(err, errBroken) {
+		t.Errorf("expect %v, got %v", errBroken, err)
+	}
+	if total != 1 || calls != 1 {
+		t.Errorf("the iteration did not stop at the error: total=%d calls=%d", total, calls)
+	}
+}
+
+func TestMap(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	names, err := sqlrange.Collect(sqlrange.Map(sqlrange.Query[person](db, `SELECT|people|age,name|`),
+		func(p person) (string, error) { return p.Name, nil },
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"Alice", "Bob", "Chris"}; !slices.Equal(names, expect) {
+		t.Errorf("expect %v, got %v", expect, names)
+	}
+
+	errBroken := errors.New("broken")
+	calls := 0
+	ages, err := sqlrange.Collect(sqlrange.Map(sqlrange.Query[person](db, `SELECT|people|age,name|`),
+		func(p person) (int, error) {
+			if calls++; p.Name == "Bob" {
+				return 0, errBroken
+			}
+			return p.Age, nil
+		},
+	))
+	if !errors.Is(err, errBroken) {
+		t.Errorf("expect %v, got %v", errBroken, err)
+	}
+	if ages != nil || calls != 2 {
+		t.Errorf("the iteration did not stop at the error: ages=%v calls=%d", ages, calls)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	for _, capacity := range []int{0, 2, 10} {
+		people, err := sqlrange.CollectN(sqlrange.Query[person](db, `SELECT|people|age,name|`), capacity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []person{
+			{Age: 1, Name: "Alice"},
+			{Age: 2, Name: "Bob"},
+			{Age: 3, Name: "Chris"},
+		}
+		if !slices.Equal(people, expect) {
+			t.Errorf("expect %v, got %v", expect, people)
+		}
+		if cap(people) < capacity {
+			t.Errorf("expect a capacity of at least %d, got %d", capacity, cap(people))
+		}
+	}
+
+	errBroken := errors.New("broken")
+	people, err := sqlrange.Collect(func(yield func(person, error) bool) {
+		_ = yield(person{Age: 1}, nil) && yield(person{}, errBroken)
+	})
+	if !errors.Is(err, errBroken) {
+		t.Errorf("expect %v, got %v", errBroken, err)
+	}
+	if people != nil {
+		t.Errorf("expect no rows, got %v", people)
+	}
+}
+
+// collected retains the results of the benchmarks so the compiler cannot
+// allocate the slices on the stack.
+var collected []person
+
+func BenchmarkCollect(b *testing.B) {
+	const N = 1000
+
+	seq := func(yield func(person, error) bool) {
+		for i := range N {
+			if !yield(person{Age: i}, nil) {
+				return
+			}
+		}
+	}
+
+	b.Run("grow", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			people, err := sqlrange.Collect(seq)
+			if err != nil {
+				b.Fatal(err)
+			}
+			collected = people
+		}
+	})
+
+	b.Run("preallocate", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			people, err := sqlrange.CollectN(seq, N)
+			if err != nil {
+				b.Fatal(err)
+			}
+			collected = people
+		}
+	})
+}
+
+func TestGroupBy(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	parity := func(p person) int { return p.Age % 2 }
+
+	groups, err := sqlrange.GroupBy(sqlrange.Query[person](db, `SELECT|people|age,name|`), parity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expect 2 groups, got %d: %v", len(groups), groups)
+	}
+	odd, even := groups[1], groups[0]
+	if len(odd) != 2 || odd[0].Name != "Alice" || odd[1].Name != "Chris" {
+		t.Errorf("wrong odd group: %v", odd)
+	}
+	if len(even) != 1 || even[0].Name != "Bob" {
+		t.Errorf("wrong even group: %v", even)
+	}
+
+	errBroken := errors.New("broken")
+	calls := 0
+	groups, err = sqlrange.GroupBy(func(yield func(person, error) bool) {
+		_ = yield(person{Age: 1}, nil) &&
+			yield(person{}, errBroken) &&
+			yield(person{Age: 2}, nil)
+	}, func(p person) int {
+		calls++
+		return parity(p)
+	})
+	if !errors.Is(err, errBroken) {
+		t.Errorf("expect %v, got %v", errBroken, err)
+	}
+	if groups != nil || calls != 1 {
+		t.Errorf("the iteration did not stop at the error: groups=%v calls=%d", groups, calls)
+	}
+}
+
+func TestTee(t *testing.T) {
+	errBroken := errors.New("broken")
+	seq := func(yield func(person, error) bool) {
+		_ = yield(person{Age: 1}, nil) &&
+			yield(person{Age: 2}, nil) &&
+			yield(person{}, errBroken)
+	}
+
+	var observed, consumed []person
+	var observedErr, consumedErr error
+	for p, err := range sqlrange.Tee(seq, func(p person, err error) {
+		if err != nil {
+			observedErr = err
+		} else {
+			observed = append(observed, p)
+		}
+	}) {
+		if err != nil {
+			consumedErr = err
+		} else {
+			consumed = append(consumed, p)
+		}
+	}
+
+	expect := []person{{Age: 1}, {Age: 2}}
+	if !slices.Equal(observed, expect) {
+		t.Errorf("observed: expect %v, got %v", expect, observed)
+	}
+	if !slices.Equal(consumed, expect) {
+		t.Errorf("consumed: expect %v, got %v", expect, consumed)
+	}
+	if !errors.Is(observedErr, errBroken) {
+		t.Errorf("observed: expect %v, got %v", errBroken, observedErr)
+	}
+	if !errors.Is(consumedErr, errBroken) {
+		t.Errorf("consumed: expect %v, got %v", errBroken, consumedErr)
+	}
+
+	calls := 0
+	for range sqlrange.Tee(seq, func(person, error) { calls++ }) {
+		break
+	}
+	if calls != 1 {
+		t.Errorf("expect 1 call after stopping the iteration, got %d", calls)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	if err := sqlrange.Drain(sqlrange.Query[person](db, `SELECT|people|age,name|`)); err != nil {
+		t.Error(err)
+	}
+
+	errBroken := errors.New("broken")
+	calls := 0
+	err := sqlrange.Drain(func(yield func(person, error) bool) {
+		calls++
+		if !yield(person{Age: 1}, nil) {
+			return
+		}
+		calls++
+		if !yield(person{}, errBroken) {
+			return
+		}
+		calls++
+		yield(person{}, errors.New("other"))
+	})
+	if !errors.Is(err, errBroken) {
+		t.Errorf("expect %v, got %v", errBroken, err)
+	}
+	if calls != 2 {
+		t.Errorf("the iteration did not stop at the first error: calls=%d", calls)
+	}
+}
+
+func TestChunkByParams(t *testing.T) {
+	type update struct {
+		ID      int
+		Columns []string
+	}
+
+	errBroken := errors.New("broken")
+	seq := func(yield func(update, error) bool) {
+		_ = yield(update{1, []string{"name", "age"}}, nil) &&
+			yield(update{2, []string{"name"}}, nil) &&
+			yield(update{3, []string{"name", "age", "email"}}, nil) &&
+			yield(update{4, []string{"name", "age", "email", "photo", "bdate"}}, nil) &&
+			yield(update{5, nil}, nil) &&
+			yield(update{6, []string{"age"}}, nil) &&
+			yield(update{}, errBroken)
+	}
+
+	// Each update has one parameter per column, plus one for the ID.
+	params := func(u update) int { return len(u.Columns) + 1 }
+
+	var batches [][]int
+	var err error
+	for batch, e := range sqlrange.ChunkByParams(seq, 5, params) {
+		if e != nil {
+			err = e
+			continue
+		}
+		ids := make([]int, len(batch))
+		for i, u := range batch {
+			ids[i] = u.ID
+		}
+		batches = append(batches, ids)
+	}
+
+	expect := [][]int{{1, 2}, {3}, {4}, {5, 6}}
+	if !slices.EqualFunc(batches, expect, slices.Equal) {
+		t.Errorf("expect %v, got %v", expect, batches)
+	}
+	if !errors.Is(err, errBroken) {
+		t.Errorf("expect %v, got %v", errBroken, err)
+	}
+}
+
+func TestSeq2FromSeq(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	people := []person{
+		{Age: 19, Name: "Luke"},
+		{Age: 42, Name: "Hitchhiker"},
+	}
+
+	for _, err := range sqlrange.Exec(db, `INSERT|people|age=?,name=?,bdate=?`,
+		sqlrange.Seq2FromSeq(slices.Values(people)),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	for p, err := range sqlrange.Query[person](db, `SELECT|people|age,name|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, p.Name)
+	}
+	if expect := []string{"Alice", "Bob", "Chris", "Luke", "Hitchhiker"}; !slices.Equal(names, expect) {
+		t.Errorf("expect %q, got %q", expect, names)
+	}
+
+	var first []person
+	for p, err := range sqlrange.Seq2FromSeq(slices.Values(people)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		first = append(first, p)
+		break
+	}
+	if expect := people[:1]; !slices.Equal(first, expect) {
+		t.Errorf("expect %v, got %v", expect, first)
+	}
+}
+
+// failingWriter is an io.Writer returning an error after n writes.
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.n--; w.n < 0 {
+		return 0, errors.New("write failed")
+	}
+	return len(b), nil
+}
+
+func TestWriteGob(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	var buf bytes.Buffer
+	if err := sqlrange.WriteGob(&buf, sqlrange.Query[person](db, `SELECT|people|age,name|`)); err != nil {
+		t.Fatal(err)
+	}
+
+	var people []person
+	dec := gob.NewDecoder(&buf)
+	for {
+		var p person
+		if err := dec.Decode(&p); err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			break
+		}
+		people = append(people, p)
+	}
+
+	expect := []person{
+		{Age: 1, Name: "Alice"},
+		{Age: 2, Name: "Bob"},
+		{Age: 3, Name: "Chris"},
+	}
+	if !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+
+	if err := sqlrange.WriteGob(&failingWriter{n: 1}, sqlrange.Query[person](db, `SELECT|people|age,name|`)); err == nil {
+		t.Error("expect an error when the writer fails")
+	}
+
+	errBroken := errors.New("broken")
+	err := sqlrange.WriteGob(io.Discard, func(yield func(person, error) bool) {
+		_ = yield(person{Age: 1}, nil) && yield(person{}, errBroken)
+	})
+	if !errors.Is(err, errBroken) {
+		t.Errorf("expect %v, got %v", errBroken, err)
+	}
+}
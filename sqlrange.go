@@ -4,11 +4,18 @@ package sqlrange
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"iter"
 	"reflect"
 	"slices"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 )
 
 // ExecOption is a functional option type to configure the [Exec] and [ExecContext]
@@ -23,10 +30,16 @@ type ExecOption[Row any] func(*execOptions[Row])
 // struct fields.
 func ExecArgsFields[Row any](columnNames ...string) ExecOption[Row] {
 	structFieldIndexes := make([][]int, len(columnNames))
+	structFieldArgs := make([]func(reflect.Value) any, len(columnNames))
 
-	for columnName, structField := range Fields(reflect.TypeOf(new(Row)).Elem()) {
-		if columnIndex := slices.Index(columnNames, columnName); columnIndex >= 0 {
-			structFieldIndexes[columnIndex] = structField.Index
+	for _, f := range cachedFieldsOf(reflect.TypeOf(new(Row)).Elem()) {
+		if columnIndex := slices.Index(columnNames, f.name); columnIndex >= 0 {
+			arg, err := fieldArg(f)
+			if err != nil {
+				panic(err)
+			}
+			structFieldIndexes[columnIndex] = f.field.Index
+			structFieldArgs[columnIndex] = arg
 		}
 	}
 
@@ -38,8 +51,53 @@ func ExecArgsFields[Row any](columnNames ...string) ExecOption[Row] {
 
 	return ExecArgs(func(args []any, row Row) []any {
 		rowValue := reflect.ValueOf(row)
-		for _, structFieldIndex := range structFieldIndexes {
-			args = append(args, rowValue.FieldByIndex(structFieldIndex).Interface())
+		for i, structFieldIndex := range structFieldIndexes {
+			args = append(args, structFieldArgs[i](rowValue.FieldByIndex(structFieldIndex)))
+		}
+		return args
+	})
+}
+
+// ExecArgsSubset constructs an option that generates the query arguments from
+// the fields mapped to the columns returned by the present function for each
+// row, followed by the fields mapped to the where columns.
+//
+// This option is useful to implement partial updates, where only the columns
+// that were set on each row are modified, see [UpdateQuery] for an example.
+//
+// The option panics if a column is not mapped to any field of the Row type.
+func ExecArgsSubset[Row any](present func(Row) []string, where ...string) ExecOption[Row] {
+	fields := cachedFieldsOf(reflect.TypeOf(new(Row)).Elem())
+	fieldArgs := make([]func(reflect.Value) any, len(fields))
+	for i, f := range fields {
+		arg, err := fieldArg(f)
+		if err != nil {
+			panic(err)
+		}
+		fieldArgs[i] = arg
+	}
+
+	appendArg := func(args []any, rowValue reflect.Value, columnName string) []any {
+		i := slices.IndexFunc(fields, func(f field) bool { return f.name == columnName })
+		if i < 0 {
+			panic(fmt.Errorf("column %q not found", columnName))
+		}
+		return append(args, fieldArgs[i](rowValue.FieldByIndex(fields[i].field.Index)))
+	}
+
+	for _, columnName := range where {
+		if !slices.ContainsFunc(fields, func(f field) bool { return f.name == columnName }) {
+			panic(fmt.Errorf("column %q not found", columnName))
+		}
+	}
+
+	return ExecArgs(func(args []any, row Row) []any {
+		rowValue := reflect.ValueOf(row)
+		for _, columnName := range present(row) {
+			args = appendArg(args, rowValue, columnName)
+		}
+		for _, columnName := range where {
+			args = appendArg(args, rowValue, columnName)
 		}
 		return args
 	})
@@ -50,7 +108,9 @@ func ExecArgsFields[Row any](columnNames ...string) ExecOption[Row] {
 //
 // By default, the Row value is converted to a list of arguments by taking the
 // fields with a "sql" struct tag in the order they appear in the struct,
-// as defined by the [reflect.VisibleFields] function.
+// as defined by the [reflect.VisibleFields] function. When Row is not a struct
+// type, the option must be set, otherwise the sequence returned by [Exec] and
+// [ExecContext] yields an error.
 //
 // The function must append the arguments to the slice passed as argument and
 // return the resulting slice.
@@ -66,13 +126,217 @@ func ExecArgs[Row any](fn func([]any, Row) []any) ExecOption[Row] {
 //
 // This is useful when parts of the query depend on the Row value that the query
 // is being executed on, for example when the query is an insert.
+//
+// It can also be combined with [ExecArgsSubset] to implement optimistic locking,
+// for example on Postgres by selecting the xmin system column into a version
+// field and only updating rows which were not modified since they were read:
+//
+//	type Account struct {
+//	  ID      int64  `sql:"id"`
+//	  Balance int64  `sql:"balance"`
+//	  Version uint32 `sql:"xmin"`
+//	}
+//
+//	columns := func(Account) []string { return []string{"balance"} }
+//	for r, err := range sqlrange.ExecSlice(ctx, tx, "", accounts,
+//	  sqlrange.ExecArgsSubset(columns, "id", "xmin"),
+//	  sqlrange.ExecQuery(func(_ string, a Account) string {
+//	    // UPDATE "accounts" SET "balance" = $1 WHERE "id" = $2 AND "xmin" = $3
+//	    return sqlrange.UpdateQuery(sqlrange.Postgres, "accounts", columns(a), "id", "xmin")
+//	  }),
+//	) {
+//	  if err != nil {
+//	    ...
+//	  }
+//	  if n, _ := r.RowsAffected(); n == 0 {
+//	    // the row was modified concurrently
+//	  }
+//	}
 func ExecQuery[Row any](fn func(string, Row) string) ExecOption[Row] {
 	return func(opts *execOptions[Row]) { opts.query = fn }
 }
 
+// ExecTimeout is an option that bounds the duration of each query execution.
+//
+// The context passed to the execution of each row is derived from the parent
+// context with a timeout of the given duration, and canceled when the query
+// returns. This prevents a single stuck statement from blocking the whole
+// sequence, in which case the error yielded for the row is
+// [context.DeadlineExceeded].
+func ExecTimeout[Row any](d time.Duration) ExecOption[Row] {
+	return func(opts *execOptions[Row]) { opts.timeout = d }
+}
+
+// ExecContinueOnError is an option that keeps executing the query for the
+// remaining rows of the sequence after an execution fails.
+//
+// By default, the sequence returned by [Exec] and [ExecContext] ends after
+// yielding the first execution error. With this option, errors are yielded for
+// each row that failed, and the iteration continues until the input sequence is
+// exhausted or the program exits the loop consuming the results.
+//
+// Note that some databases like Postgres abort the transaction when a query
+// fails, in which case the option is only useful when combined with
+// [ExecSavepoint].
+func ExecContinueOnError[Row any]() ExecOption[Row] {
+	return func(opts *execOptions[Row]) { opts.continueOnError = true }
+}
+
+// ExecSavepoint is an option that periodically creates savepoints when
+// executing the query, which is useful to avoid losing all the work done by a
+// large batch when a failure occurs near the end.
+//
+// A savepoint is created before executing the query for the first row, and
+// released after every n rows, at which point a new savepoint is created for
+// the next rows. When an execution fails, the transaction is rolled back to the
+// last savepoint, undoing the executions of the rows since that savepoint but
+// preserving the ones before it. When combined with [ExecContinueOnError], the
+// execution then resumes with the next row and a new savepoint.
+//
+// The option issues SAVEPOINT, RELEASE SAVEPOINT, and ROLLBACK TO SAVEPOINT
+// statements, it must be used with an [Executable] which is a transaction on a
+// database supporting them. The savepoint is also released when the program
+// stops the iteration early; since no error can be yielded at that point, a
+// failure to release it is only counted by the metrics (see [WithMetrics]), and
+// the transaction should then be rolled back.
+func ExecSavepoint[Row any](n int) ExecOption[Row] {
+	return func(opts *execOptions[Row]) { opts.savepoint = n }
+}
+
+// ExecRequireAffected is an option that treats the executions affecting fewer
+// than n rows as failures, which is useful to detect updates or deletes of
+// rows that did not exist, often indicating a logic error in the program:
+//
+//	for _, err := range sqlrange.ExecContext(ctx, tx, query, rows,
+//	  sqlrange.ExecRequireAffected[Row](1),
+//	) {
+//	  if errors.Is(err, sqlrange.ErrTooFewRowsAffected) {
+//	    ...
+//	  }
+//	}
+//
+// The error yielded for the row is an [ExecError] wrapping
+// [ErrTooFewRowsAffected], and it is handled like other execution errors, for
+// example the iteration continues with the next rows when combined with
+// [ExecContinueOnError]. An error is also yielded if the driver does not
+// support reporting the number of affected rows.
+func ExecRequireAffected[Row any](n int64) ExecOption[Row] {
+	return func(opts *execOptions[Row]) { opts.minAffected = n }
+}
+
+// ErrTooFewRowsAffected is the error wrapped by the errors yielded when a
+// query affects fewer rows than required by [ExecRequireAffected].
+var ErrTooFewRowsAffected = errors.New("too few rows affected")
+
 type execOptions[Row any] struct {
-	args  func([]any, Row) []any
-	query func(string, Row) string
+	args            func([]any, Row) []any
+	query           func(string, Row) string
+	timeout         time.Duration
+	continueOnError bool
+	savepoint       int
+	minAffected     int64
+	before          []func(context.Context, *sql.Tx) error
+	after           []func(context.Context, *sql.Tx) error
+}
+
+// ExecBefore constructs an option registering a function called by [ExecTx]
+// after beginning the transaction and before executing the queries, which is
+// useful to configure the session, for example to defer the checks of foreign
+// keys when inserting rows which reference each other:
+//
+//	err := sqlrange.ExecTx(ctx, db, nil, query, rows,
+//	  sqlrange.ExecBefore[Row](func(ctx context.Context, tx *sql.Tx) error {
+//	    _, err := tx.ExecContext(ctx, `SET CONSTRAINTS ALL DEFERRED`)
+//	    return err
+//	  }),
+//	)
+//
+// When the option is used multiple times, the functions are called in order.
+// If a function returns an error, the transaction is rolled back and the error
+// is returned by [ExecTx]. The option is ignored by the other functions.
+func ExecBefore[Row any](fn func(context.Context, *sql.Tx) error) ExecOption[Row] {
+	return func(opts *execOptions[Row]) { opts.before = append(opts.before, fn) }
+}
+
+// ExecAfter constructs an option registering a function called by [ExecTx]
+// after executing the queries successfully and before committing the
+// transaction, for example to write an audit record or verify invariants.
+//
+// When the option is used multiple times, the functions are called in order.
+// If a function returns an error, the transaction is rolled back and the error
+// is returned by [ExecTx]. The option is ignored by the other functions.
+func ExecAfter[Row any](fn func(context.Context, *sql.Tx) error) ExecOption[Row] {
+	return func(opts *execOptions[Row]) { opts.after = append(opts.after, fn) }
+}
+
+// requireAffected returns an error if the result reports fewer affected rows
+// than required by the ExecRequireAffected option.
+func (opts *execOptions[Row]) requireAffected(res sql.Result) error {
+	if opts.minAffected <= 0 {
+		return nil
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n < opts.minAffected {
+		return fmt.Errorf("%w: %d < %d", ErrTooFewRowsAffected, n, opts.minAffected)
+	}
+	return nil
+}
+
+// defaultArgs returns the function generating the query arguments from the
+// fields of Row, which is used when the ExecArgs option is not set.
+func defaultArgs[Row any](hooks *hooks) (func([]any, Row) []any, error) {
+	row := new(Row)
+	val := reflect.ValueOf(row).Elem()
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot generate query arguments from values of type %s (use sqlrange.ExecArgs to configure how rows are converted to arguments)", val.Type())
+	}
+	fields := hooks.fields(val.Type())
+	fieldArgs := make([]func(reflect.Value) any, len(fields))
+	for i, f := range fields {
+		arg, err := fieldArg(f)
+		if err != nil {
+			return nil, err
+		}
+		fieldArgs[i] = arg
+	}
+	return func(args []any, in Row) []any {
+		*row = in
+		for i, f := range fields {
+			args = append(args, fieldArgs[i](val.FieldByIndex(f.field.Index)))
+		}
+		return args
+	}, nil
+}
+
+// Args returns the query arguments that [Exec] and [ExecContext] generate for a
+// row, without executing any query. This is useful to test the functions passed
+// to [ExecArgs], or to inspect the default mapping of fields to arguments:
+//
+//	args := sqlrange.Args(user)
+//	// args: []any{user.ID, user.Name}
+//
+// The options which do not configure the arguments, such as [ExecQuery], are
+// ignored. The context hooks do not apply, the default arguments are the values
+// of the fields in the order defined by [Fields].
+//
+// The function panics if Row is not a struct type and the [ExecArgs] option is
+// not set, or if the fields have invalid tag options.
+func Args[Row any](row Row, opts ...ExecOption[Row]) []any {
+	options := new(execOptions[Row])
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.args == nil {
+		args, err := defaultArgs[Row](new(hooks))
+		if err != nil {
+			panic(err)
+		}
+		options.args = args
+	}
+	return options.args(nil, row)
 }
 
 // Executable is the interface implemented by [sql.DB], [sql.Conn], or [sql.Tx].
@@ -105,6 +369,8 @@ func Exec[Row any](e Executable, query string, seq iter.Seq2[Row, error], opts .
 //	  ...
 //	}
 //
+// The [ExecTx] function implements this pattern.
+//
 // Since the function makes one query execution for each row read from the
 // sequence, latency of the query execution can quickly increase. In some cases,
 // such as inserting values in a database, the program can amortize the cost of
@@ -125,217 +391,2150 @@ func Exec[Row any](e Executable, query string, seq iter.Seq2[Row, error], opts .
 //		}),
 //		// generate placeholders for the insert query
 //		sqlrange.ExecQuery(func(query string, rows []RowType) string {
-//		  return query + strings.Repeat(`(?, ?, ?)`, len(rows))
+//		  return query + sqlrange.PlaceholderRows(3, len(rows), sqlrange.Question)
 //		}),
 //	) {
 //		...
 //	}
 //
 // Batching operations this way is necessary to achieve high throughput when
-// inserting values into a database.
+// inserting values into a database. When the batches have a fixed size, the
+// placeholders can be computed once, see [PlaceholderRows].
+//
+// A nil sequence is treated as an empty sequence, for which no queries are
+// executed and no results are yielded.
+//
+// By default, the query arguments are the values of the fields of the rows, in
+// the order defined by [Fields]. The values are passed to database/sql as they
+// are, including pointers and custom types, so drivers implementing
+// [driver.NamedValueChecker] receive them unchanged and can support types that
+// [driver.DefaultParameterConverter] rejects. The exceptions are the fields
+// converted by the package: types registered with [RegisterConverter] or
+// [RegisterTagConverter], fields with the "sentinel" tag option, types
+// implementing [encoding.TextMarshaler] but not [driver.Valuer], which are
+// passed as text, and [json.RawMessage], which is passed as a byte slice.
 func ExecContext[Row any](ctx context.Context, e Executable, query string, seq iter.Seq2[Row, error], opts ...ExecOption[Row]) iter.Seq2[sql.Result, error] {
 	return func(yield func(sql.Result, error) bool) {
+		if seq == nil {
+			return
+		}
+
+		hooks := hooksFrom(ctx)
+		yield = countYield(&hooks, yield, false)
+
 		options := new(execOptions[Row])
 		for _, opt := range opts {
 			opt(options)
 		}
 
 		if options.args == nil {
-			row := new(Row)
-			val := reflect.ValueOf(row).Elem()
-			fields := Fields(val.Type())
-			options.args = func(args []any, in Row) []any {
-				*row = in
-				for _, structField := range fields {
-					args = append(args, val.FieldByIndex(structField.Index).Interface())
-				}
-				return args
+			args, err := defaultArgs[Row](&hooks)
+			if err != nil {
+				yield(nil, err)
+				return
 			}
+			options.args = args
 		}
 
 		if options.query == nil {
 			options.query = func(query string, _ Row) string { return query }
 		}
 
+		savepoint := &savepoint{
+			ctx:     ctx,
+			e:       e,
+			timeout: options.timeout,
+			every:   options.savepoint,
+		}
+
 		var execArgs []any
 		var execQuery string
+		index := -1
 		for r, err := range seq {
+			index++
 			if err != nil {
+				if releaseErr := savepoint.release(); releaseErr != nil {
+					err = errors.Join(err, releaseErr)
+				}
 				yield(nil, err)
 				return
 			}
 			execArgs = options.args(execArgs[:0], r)
 			execQuery = options.query(query, r)
 
-			res, err := e.ExecContext(ctx, execQuery, execArgs...)
-			if !yield(res, err) {
+			rewritten, err := hooks.query(ctx, execQuery)
+			if err != nil {
+				yield(nil, newExecError(index, execQuery, execArgs, err))
+				return
+			}
+			execQuery = rewritten
+
+			if err := hooks.validate(execQuery, execArgs); err != nil {
+				yield(nil, newExecError(index, execQuery, execArgs, err))
+				return
+			}
+
+			if err := savepoint.begin(); err != nil {
+				yield(nil, err)
 				return
 			}
+
+			hooks.incQueries()
+			start := hooks.start()
+			res, err := execContext(ctx, e, execQuery, execArgs, options.timeout)
+			hooks.observe(execQuery, start, err)
+			if err == nil {
+				err = options.requireAffected(res)
+			}
 			if err != nil {
+				err = newExecError(index, execQuery, execArgs, err)
+				if rollbackErr := savepoint.rollback(); rollbackErr != nil {
+					yield(res, errors.Join(err, rollbackErr))
+					return
+				}
+			} else if err := savepoint.next(); err != nil {
+				yield(nil, err)
 				return
 			}
-		}
-	}
-}
 
-// Queryable is an interface implemented by types that can send SQL queries,
-// such as [sql.DB], [sql.Conn], or [sql.Tx].
-type Queryable interface {
-	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
-}
+			if !yield(res, err) {
+				// The error cannot be yielded after the iteration was
+				// stopped, it is only reported to the metrics.
+				if err := savepoint.release(); err != nil {
+					hooks.incErrors()
+				}
+				return
+			}
+			if err != nil && !options.continueOnError {
+				return
+			}
+		}
 
-// Query is like [QueryContext] but it uses the background context.
-func Query[Row any](q Queryable, query string, args ...any) iter.Seq2[Row, error] {
-	return QueryContext[Row](context.Background(), q, query, args...)
+		if err := savepoint.release(); err != nil {
+			yield(nil, err)
+		}
+	}
 }
 
-// QueryContext returns the results of the query as a sequence of rows.
-//
-// The returned function automatically closes the underlying [sql.Rows] value when
-// it completes its iteration.
-//
-// A typical use of QueryContext is:
+// ExecSlice is like [ExecContext] but it executes the query for each element of
+// a slice, which avoids constructing a sequence when the rows are already held
+// in memory:
 //
-//	for row, err := range sqlrange.QueryContext[RowType](ctx, db, query, args...) {
-//	  if err != nil {
-//	    ...
-//	  }
+//	for r, err := range sqlrange.ExecSlice(ctx, tx, query, rows) {
 //	  ...
 //	}
+func ExecSlice[Row any](ctx context.Context, e Executable, query string, rows []Row, opts ...ExecOption[Row]) iter.Seq2[sql.Result, error] {
+	return ExecContext(ctx, e, query, func(yield func(Row, error) bool) {
+		for _, row := range rows {
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}, opts...)
+}
+
+// ExecAll is like [ExecContext] with the [ExecContinueOnError] option, but it
+// consumes the results and returns the errors of all the rows that failed,
+// combined with [errors.Join], or nil if all the executions succeeded. This is
+// useful for best-effort batch jobs, for example:
 //
-// The q parameter represents a queryable type, such as [sql.DB], [sql.Conn],
-// or [sql.Tx].
+//	if err := sqlrange.ExecAll(ctx, db, query, rows); err != nil {
+//	  log.Printf("some rows failed: %v", err)
+//	}
 //
-// See [Scan] for more information about how the rows are mapped to the row type
-// parameter Row.
-func QueryContext[Row any](ctx context.Context, q Queryable, query string, args ...any) iter.Seq2[Row, error] {
-	return func(yield func(Row, error) bool) {
-		if rows, err := q.QueryContext(ctx, query, args...); err != nil {
-			var zero Row
-			yield(zero, err)
-		} else {
-			scan[Row](yield, rows)
+// The errors of the executions are of type [ExecError], which programs can use
+// to determine which rows failed. An error yielded by the input sequence still
+// ends the iteration, and is returned along with the previous errors.
+func ExecAll[Row any](ctx context.Context, e Executable, query string, seq iter.Seq2[Row, error], opts ...ExecOption[Row]) error {
+	opts = append(slices.Clip(opts), ExecContinueOnError[Row]())
+	var errs []error
+	for _, err := range ExecContext(ctx, e, query, seq, opts...) {
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
 }
 
-// Scan returns a sequence of rows from a [sql.Rows] value.
-//
-// The returned function automatically closes the rows passed as argument when
-// it completes its iteration.
-//
-// A typical use of Scan is:
+// ExecResult is like [ExecContext] but it consumes the results and returns the
+// total number of rows affected by the executions, which is the terminal
+// operation needed by most batch inserts:
 //
-//	rows, err := db.QueryContext(ctx, query, args...)
+//	n, err := sqlrange.ExecResult(ctx, tx, query, rows)
 //	if err != nil {
 //	  ...
 //	}
-//	for row, err := range sqlrange.Scan[RowType](rows) {
-//	  if err != nil {
-//	    ...
-//	  }
+//	log.Printf("%d rows inserted", n)
+//
+// The iteration stops at the first error, which is returned along with the
+// number of rows affected by the executions that succeeded before it.
+func ExecResult[Row any](ctx context.Context, e Executable, query string, seq iter.Seq2[Row, error], opts ...ExecOption[Row]) (int64, error) {
+	var total int64
+	for r, err := range ExecContext(ctx, e, query, seq, opts...) {
+		if err != nil {
+			return total, err
+		}
+		n, err := r.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// ExecMulti is like [ExecContext] but it executes multiple queries for each row
+// of the sequence, in order, which is useful to write related rows to multiple
+// tables within a transaction, for example:
+//
+//	for r, err := range sqlrange.ExecMulti(ctx, tx,
+//	  []string{
+//	    `INSERT INTO orders (id, customer) VALUES ($1, $2)`,
+//	    `INSERT INTO order_events (order_id, kind) VALUES ($1, 'created')`,
+//	  },
+//	  orders,
+//	  []func([]any, Order) []any{
+//	    func(args []any, o Order) []any { return append(args, o.ID, o.Customer) },
+//	    func(args []any, o Order) []any { return append(args, o.ID) },
+//	  },
+//	) {
 //	  ...
 //	}
 //
-// Scan uses reflection to map the columns of the rows to the fields of the
-// struct passed as argument. The mapping is done by matching the name of the
-// columns with the name of the fields. The name of the columns is taken from
-// the "sql" tag of the fields. For example:
+// The arguments of each query are generated by the function at the same index
+// in argsPerQuery. The sequence yields the result of each query, so it yields
+// len(queries) results for each row. The iteration stops at the first error,
+// the errors of the executions are of type [ExecError], with the index of the
+// row that the query was executed for.
+func ExecMulti[Row any](ctx context.Context, e Executable, queries []string, seq iter.Seq2[Row, error], argsPerQuery []func([]any, Row) []any) iter.Seq2[sql.Result, error] {
+	return func(yield func(sql.Result, error) bool) {
+		if len(queries) != len(argsPerQuery) {
+			yield(nil, fmt.Errorf("%d queries but %d argument functions", len(queries), len(argsPerQuery)))
+			return
+		}
+		if seq == nil || len(queries) == 0 {
+			return
+		}
+
+		type statement struct {
+			row   Row
+			query int
+		}
+
+		statements := func(yield func(statement, error) bool) {
+			for row, err := range seq {
+				if err != nil {
+					yield(statement{}, err)
+					return
+				}
+				for i := range queries {
+					if !yield(statement{row, i}, nil) {
+						return
+					}
+				}
+			}
+		}
+
+		for r, err := range ExecContext(ctx, e, "", statements,
+			ExecQuery(func(_ string, s statement) string { return queries[s.query] }),
+			ExecArgs(func(args []any, s statement) []any { return argsPerQuery[s.query](args, s.row) }),
+		) {
+			var execErr *ExecError
+			if errors.As(err, &execErr) {
+				// The index counts the statements, report the index of the row
+				// instead.
+				execErr.Index /= len(queries)
+			}
+			if !yield(r, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// TxBeginner is the interface implemented by [sql.DB] and [sql.Conn] to begin
+// transactions.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// ExecTx is like [ExecContext] but it executes the queries in a transaction,
+// which is committed if all the executions succeeded, and rolled back
+// otherwise:
 //
-//	type Row struct {
-//	  ID   int64  `sql:"id"`
-//	  Name string `sql:"name"`
+//	if err := sqlrange.ExecTx(ctx, db, nil, query, rows); err != nil {
+//	  ...
 //	}
 //
-// The fields of the struct that do not have a "sql" tag are ignored.
+// The transaction is started with the txOpts options, which may be nil. The
+// [ExecBefore] and [ExecAfter] options register functions called on the
+// transaction before and after executing the queries, for example to configure
+// the session.
 //
-// Ranging over the returned function will panic if the type parameter is not a
-// struct.
-func Scan[Row any](rows *sql.Rows) iter.Seq2[Row, error] {
-	return func(yield func(Row, error) bool) { scan(yield, rows) }
-}
-
-func scan[Row any](yield func(Row, error) bool, rows *sql.Rows) {
-	defer rows.Close()
-	var zero Row
+// The iteration stops at the first error, which is returned by the function
+// after rolling back the transaction. An error rolling back the transaction is
+// joined to it.
+func ExecTx[Row any](ctx context.Context, db TxBeginner, txOpts *sql.TxOptions, query string, seq iter.Seq2[Row, error], opts ...ExecOption[Row]) error {
+	options := new(execOptions[Row])
+	for _, opt := range opts {
+		opt(options)
+	}
 
-	columns, err := rows.Columns()
+	tx, err := db.BeginTx(ctx, txOpts)
 	if err != nil {
-		yield(zero, err)
-		return
+		return err
 	}
 
-	scanArgs := make([]any, len(columns))
-	row := new(Row)
-	val := reflect.ValueOf(row).Elem()
-
-	for columnName, structField := range Fields(val.Type()) {
-		if columnIndex := slices.Index(columns, columnName); columnIndex >= 0 {
-			scanArgs[columnIndex] = val.FieldByIndex(structField.Index).Addr().Interface()
+	if err := execTx(ctx, tx, query, seq, options, opts); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			err = errors.Join(err, rollbackErr)
 		}
+		return err
 	}
+	return tx.Commit()
+}
 
-	for rows.Next() {
-		if err := rows.Scan(scanArgs...); err != nil {
-			yield(zero, err)
-			return
+func execTx[Row any](ctx context.Context, tx *sql.Tx, query string, seq iter.Seq2[Row, error], options *execOptions[Row], opts []ExecOption[Row]) error {
+	for _, before := range options.before {
+		if err := before(ctx, tx); err != nil {
+			return err
 		}
-		if !yield(*row, nil) {
-			return
+	}
+	if err := Drain(ExecContext(ctx, tx, query, seq, opts...)); err != nil {
+		return err
+	}
+	for _, after := range options.after {
+		if err := after(ctx, tx); err != nil {
+			return err
 		}
-		*row = zero
 	}
+	return nil
+}
 
-	if err := rows.Err(); err != nil {
-		yield(zero, err)
-	}
+// ExecError is the type of errors yielded by [Exec] and [ExecContext] when the
+// execution of the query fails for a row of the input sequence.
+//
+// Programs can use [errors.As] to determine which row caused the failure:
+//
+//	var execErr *sqlrange.ExecError
+//	if errors.As(err, &execErr) {
+//	  log.Printf("row %d failed: %v", execErr.Index, execErr.Err)
+//	}
+//
+// The error also carries the query and the arguments of the failed execution,
+// which allows reproducing the failure.
+type ExecError struct {
+	// Index is the zero-based position of the row in the input sequence.
+	Index int
+	// Query is the query executed for the row, as returned by the function of
+	// the [ExecQuery] option and rewritten by the [QueryRewriter] installed on
+	// the context. When the rewriter failed, it is the query before rewriting.
+	Query string
+	// Args is a copy of the arguments passed with the query.
+	Args []any
+	// Err is the error returned when executing the query.
+	Err error
 }
 
-// Fields returns a sequence of the fields of a struct type that have a "sql"
-// tag.
-func Fields(t reflect.Type) iter.Seq2[string, reflect.StructField] {
-	return func(yield func(string, reflect.StructField) bool) {
-		cache, _ := cachedFields.Load().(map[reflect.Type][]field)
+func newExecError(index int, query string, args []any, err error) *ExecError {
+	return &ExecError{Index: index, Query: query, Args: slices.Clone(args), Err: err}
+}
 
-		fields, ok := cache[t]
-		if !ok {
-			fields = appendFields(nil, t, nil)
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("executing query for row %d: %v", e.Index, e.Err)
+}
 
-			newCache := make(map[reflect.Type][]field, len(cache)+1)
-			for k, v := range cache {
-				newCache[k] = v
-			}
-			newCache[t] = fields
-			cachedFields.Store(newCache)
-		}
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
 
-		for _, f := range fields {
-			if !yield(f.name, f.field) {
-				return
-			}
-		}
-	}
+// savepoint manages the savepoints created when using the ExecSavepoint option.
+//
+// All methods are no-ops when the option is not set.
+type savepoint struct {
+	ctx     context.Context
+	e       Executable
+	timeout time.Duration
+	every   int  // number of rows between savepoints, zero when disabled
+	count   int  // number of rows executed since the savepoint was created
+	active  bool // whether a savepoint is currently open
 }
 
-type field struct {
-	name  string
-	field reflect.StructField
+const savepointName = "sqlrange_savepoint"
+
+func (s *savepoint) exec(stmt string) error {
+	_, err := execContext(s.ctx, s.e, stmt, nil, s.timeout)
+	return err
 }
 
-var cachedFields atomic.Value // map[reflect.Type][]field
+// begin creates a savepoint if none is currently open.
+func (s *savepoint) begin() error {
+	if s.every <= 0 || s.active {
+		return nil
+	}
+	s.active, s.count = true, 0
+	return s.exec("SAVEPOINT " + savepointName)
+}
 
-func appendFields(fields []field, t reflect.Type, index []int) []field {
-	for i, n := 0, t.NumField(); i < n; i++ {
-		if f := t.Field(i); f.IsExported() {
+// next must be called after a successful execution, it releases the savepoint
+// when enough rows were executed since it was created.
+func (s *savepoint) next() error {
+	if !s.active {
+		return nil
+	}
+	if s.count++; s.count < s.every {
+		return nil
+	}
+	return s.release()
+}
+
+// release releases the current savepoint, if any.
+func (s *savepoint) release() error {
+	if !s.active {
+		return nil
+	}
+	s.active = false
+	return s.exec("RELEASE SAVEPOINT " + savepointName)
+}
+
+// rollback rolls back to the current savepoint, if any, then releases it.
+func (s *savepoint) rollback() error {
+	if !s.active {
+		return nil
+	}
+	s.active = false
+	if err := s.exec("ROLLBACK TO SAVEPOINT " + savepointName); err != nil {
+		return err
+	}
+	return s.exec("RELEASE SAVEPOINT " + savepointName)
+}
+
+func execContext(ctx context.Context, e Executable, query string, args []any, timeout time.Duration) (sql.Result, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return e.ExecContext(ctx, query, args...)
+}
+
+// Result is the result of a query execution returned by [ExecResults].
+//
+// The embedded [sql.Result] is the value returned by the [Executable].
+type Result struct {
+	sql.Result
+	// CommandTag is the command tag reported by the database for the query
+	// execution (e.g. "INSERT 0 3" on Postgres), or an empty string if the
+	// result did not implement the [CommandTagger] interface.
+	CommandTag string
+}
+
+// CommandTagger is an interface implemented by results carrying the command tag
+// reported by the database.
+//
+// Note that [sql.DB], [sql.Conn], and [sql.Tx] hide the results produced by
+// drivers, so the interface can only be detected when the [Executable] returns
+// richer results itself, which is the case of types adapting native database
+// clients to the [Executable] interface.
+type CommandTagger interface {
+	CommandTag() string
+}
+
+// ExecResults is like [ExecContext] but it yields values of type [Result],
+// surfacing the metadata of results that carry more information than what
+// [sql.Result] exposes.
+func ExecResults[Row any](ctx context.Context, e Executable, query string, seq iter.Seq2[Row, error], opts ...ExecOption[Row]) iter.Seq2[Result, error] {
+	return func(yield func(Result, error) bool) {
+		for res, err := range ExecContext(ctx, e, query, seq, opts...) {
+			r := Result{Result: res}
+			if t, ok := res.(CommandTagger); ok {
+				r.CommandTag = t.CommandTag()
+			}
+			if !yield(r, err) {
+				return
+			}
+		}
+	}
+}
+
+// Queryable is an interface implemented by types that can send SQL queries,
+// such as [sql.DB], [sql.Conn], or [sql.Tx].
+type Queryable interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Query is like [QueryContext] but it uses the background context.
+func Query[Row any](q Queryable, query string, args ...any) iter.Seq2[Row, error] {
+	return QueryContext[Row](context.Background(), q, query, args...)
+}
+
+// QueryContext returns the results of the query as a sequence of rows.
+//
+// The returned function automatically closes the underlying [sql.Rows] value when
+// it completes its iteration.
+//
+// A typical use of QueryContext is:
+//
+//	for row, err := range sqlrange.QueryContext[RowType](ctx, db, query, args...) {
+//	  if err != nil {
+//	    ...
+//	  }
+//	  ...
+//	}
+//
+// The q parameter represents a queryable type, such as [sql.DB], [sql.Conn],
+// or [sql.Tx].
+//
+// See [Scan] for more information about how the rows are mapped to the row type
+// parameter Row. Values of type [ScanOption] passed in args configure the scan
+// of the results and are not passed to the database.
+func QueryContext[Row any](ctx context.Context, q Queryable, query string, args ...any) iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		hooks := hooksFrom(ctx)
+
+		query, err := hooks.query(ctx, query)
+		if err != nil {
+			hooks.incErrors()
+			var zero Row
+			yield(zero, err)
+			return
+		}
+
+		queryRewritten[Row](ctx, &hooks, yield, q, query, args)
+	}
+}
+
+// queryRewritten is the implementation of QueryContext after the query was
+// rewritten by the context hooks.
+func queryRewritten[Row any](ctx context.Context, hooks *hooks, yield func(Row, error) bool, q Queryable, query string, args []any) {
+	var zero Row
+	args, opts := splitScanOptions(args)
+
+	if err := hooks.validate(query, args); err != nil {
+		hooks.incErrors()
+		yield(zero, err)
+		return
+	}
+
+	hooks.incQueries()
+	start := hooks.start()
+	rows, err := q.QueryContext(ctx, query, args...)
+	hooks.observe(query, start, err)
+	if err != nil {
+		hooks.incErrors()
+		yield(zero, err)
+	} else {
+		options := newScanOptions(opts)
+		// The rows are not visible to the caller, so they must always be
+		// closed when the iteration completes.
+		options.noClose = false
+		scan[Row](ctx, yield, rows, options)
+	}
+}
+
+// QueryEach executes a query for each value of the input sequence, and returns
+// the concatenation of their results as a single sequence of rows.
+//
+// The args function is called for each input value to generate the arguments
+// of the query. This is useful for per-entity queries driven by an input
+// stream, or for statements returning values such as INSERT ... RETURNING:
+//
+//	for row, err := range sqlrange.QueryEach[Input, Output](ctx, tx,
+//	  `INSERT INTO table (col1, col2) VALUES ($1, $2) RETURNING id, created_at`,
+//	  inputs,
+//	  func(in Input) []any { return []any{in.Col1, in.Col2} },
+//	) {
+//	  ...
+//	}
+//
+// The iteration stops at the first error, whether it came from the input
+// sequence or from one of the queries.
+func QueryEach[In, Out any](ctx context.Context, q Queryable, query string, seq iter.Seq2[In, error], args func(In) []any) iter.Seq2[Out, error] {
+	return func(yield func(Out, error) bool) {
+		if seq == nil {
+			return
+		}
+		for in, err := range seq {
+			if err != nil {
+				var zero Out
+				yield(zero, err)
+				return
+			}
+			for out, err := range QueryContext[Out](ctx, q, query, args(in)...) {
+				if !yield(out, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// QueryBatch is like [QueryEach] but it executes the query for each element of
+// a slice, which is useful for fan-out lookups when a single query with an IN
+// clause is not feasible:
+//
+//	for order, err := range sqlrange.QueryBatch[User, Order](ctx, db,
+//	  `SELECT * FROM orders WHERE user_id = $1 ORDER BY created_at DESC LIMIT 10`,
+//	  users,
+//	  func(u User) []any { return []any{u.ID} },
+//	) {
+//	  ...
+//	}
+func QueryBatch[In, Out any](ctx context.Context, q Queryable, query string, inputs []In, args func(In) []any) iter.Seq2[Out, error] {
+	return QueryEach[In, Out](ctx, q, query, func(yield func(In, error) bool) {
+		for _, in := range inputs {
+			if !yield(in, nil) {
+				return
+			}
+		}
+	}, args)
+}
+
+// QueryCounted is like [QueryContext] but it also returns a function reporting
+// the number of rows yielded by the sequence, which is useful to log the size
+// of result sets without tallying them in the loop:
+//
+//	rows, count := sqlrange.QueryCounted[Row](ctx, db, query)
+//	for row, err := range rows {
+//	  ...
+//	}
+//	log.Printf("%d rows", count())
+//
+// The count includes the rows yielded so far, it does not include errors and
+// is reset each time the iteration starts over. The function may be called
+// concurrently with the iteration.
+func QueryCounted[Row any](ctx context.Context, q Queryable, query string, args ...any) (iter.Seq2[Row, error], func() int) {
+	var count atomic.Int64
+	seq := QueryContext[Row](ctx, q, query, args...)
+	return func(yield func(Row, error) bool) {
+		count.Store(0)
+		for row, err := range seq {
+			if err == nil {
+				count.Add(1)
+			}
+			if !yield(row, err) {
+				return
+			}
+		}
+	}, func() int { return int(count.Load()) }
+}
+
+// QueryScalar executes a query returning a single row with a single column, and
+// returns the value of that column.
+//
+// The function is intended for aggregate queries (e.g. SELECT MAX(age) FROM
+// people), the value is scanned directly into a value of type T, which can be
+// any type supported by [sql.Rows.Scan], such as int64, string, or time.Time.
+//
+// If the query returns no rows, the function returns [sql.ErrNoRows]. An error
+// is returned if the query returns more than one column or more than one row.
+func QueryScalar[T any](ctx context.Context, q Queryable, query string, args ...any) (T, error) {
+	hooks := hooksFrom(ctx)
+	value, err := queryScalar[T](ctx, &hooks, q, query, args)
+	if err != nil {
+		hooks.incErrors()
+	}
+	return value, err
+}
+
+func queryScalar[T any](ctx context.Context, hooks *hooks, q Queryable, query string, args []any) (T, error) {
+	var value, zero T
+
+	query, err := hooks.query(ctx, query)
+	if err != nil {
+		return zero, err
+	}
+	if err := hooks.validate(query, args); err != nil {
+		return zero, err
+	}
+
+	hooks.incQueries()
+	start := hooks.start()
+	rows, err := q.QueryContext(ctx, query, args...)
+	hooks.observe(query, start, err)
+	if err != nil {
+		return zero, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return zero, err
+	}
+	if len(columns) != 1 {
+		return zero, fmt.Errorf("scalar query must return exactly one column, got %d", len(columns))
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return zero, err
+		}
+		return zero, sql.ErrNoRows
+	}
+	if err := rows.Scan(&value); err != nil {
+		return zero, err
+	}
+	hooks.incRows()
+	if rows.Next() {
+		return zero, errors.New("scalar query must return exactly one row, got more")
+	}
+	if err := rows.Err(); err != nil {
+		return zero, err
+	}
+	return value, rows.Close()
+}
+
+// QueryMap executes a query returning two columns, and returns a map of the
+// values of the first column to the values of the second column.
+//
+// The function is intended for queries grouping rows by a key, for example:
+//
+//	ages, err := sqlrange.QueryMap[string, int](ctx, db,
+//	  `SELECT name, MAX(age) FROM people GROUP BY name`,
+//	)
+//
+// The keys and values are scanned directly into values of type K and V, which
+// can be any type supported by [sql.Rows.Scan]. When multiple rows have the
+// same key, the value of the last row is retained in the map. An error is
+// returned if the query does not return exactly two columns.
+func QueryMap[K comparable, V any](ctx context.Context, q Queryable, query string, args ...any) (map[K]V, error) {
+	hooks := hooksFrom(ctx)
+	values, err := queryMap[K, V](ctx, &hooks, q, query, args)
+	if err != nil {
+		hooks.incErrors()
+	}
+	return values, err
+}
+
+func queryMap[K comparable, V any](ctx context.Context, hooks *hooks, q Queryable, query string, args []any) (map[K]V, error) {
+	query, err := hooks.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if err := hooks.validate(query, args); err != nil {
+		return nil, err
+	}
+
+	hooks.incQueries()
+	start := hooks.start()
+	rows, err := q.QueryContext(ctx, query, args...)
+	hooks.observe(query, start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != 2 {
+		return nil, fmt.Errorf("map query must return exactly two columns, got %d", len(columns))
+	}
+
+	values := make(map[K]V)
+	for rows.Next() {
+		var key K
+		var value V
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		hooks.incRows()
+		values[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return values, rows.Close()
+}
+
+// ErrDuplicateKey is the error returned by [QueryKeyedBy] when multiple rows
+// have the same key.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// QueryKeyedBy executes a query and returns a map of the rows indexed by the
+// key returned by the key function for each row, which is useful to load lookup
+// tables in memory, for example:
+//
+//	users, err := sqlrange.QueryKeyedBy(ctx, db, `SELECT * FROM users`,
+//	  func(u User) int64 { return u.ID },
+//	)
+//
+// When multiple rows have the same key, the function returns an error wrapping
+// [ErrDuplicateKey], see [QueryKeyedByLastWins] to retain the last row instead.
+func QueryKeyedBy[Row any, K comparable](ctx context.Context, q Queryable, query string, key func(Row) K, args ...any) (map[K]Row, error) {
+	return queryKeyedBy(ctx, q, query, key, false, args)
+}
+
+// QueryKeyedByLastWins is like [QueryKeyedBy], but when multiple rows have the
+// same key, the last row with each key is retained in the map instead of
+// returning an error.
+func QueryKeyedByLastWins[Row any, K comparable](ctx context.Context, q Queryable, query string, key func(Row) K, args ...any) (map[K]Row, error) {
+	return queryKeyedBy(ctx, q, query, key, true, args)
+}
+
+func queryKeyedBy[Row any, K comparable](ctx context.Context, q Queryable, query string, key func(Row) K, lastWins bool, args []any) (map[K]Row, error) {
+	rows := make(map[K]Row)
+	for row, err := range QueryContext[Row](ctx, q, query, args...) {
+		if err != nil {
+			return nil, err
+		}
+		k := key(row)
+		if _, exists := rows[k]; exists && !lastWins {
+			return nil, fmt.Errorf("%w: %v", ErrDuplicateKey, k)
+		}
+		rows[k] = row
+	}
+	return rows, nil
+}
+
+// QueryCountMap is like [QueryMap] for the common case of queries counting the
+// rows of each group, for example:
+//
+//	counts, err := sqlrange.QueryCountMap[string](ctx, db,
+//	  `SELECT status, COUNT(*) FROM orders GROUP BY status`,
+//	)
+func QueryCountMap[K comparable](ctx context.Context, q Queryable, query string, args ...any) (map[K]int64, error) {
+	return QueryMap[K, int64](ctx, q, query, args...)
+}
+
+// CopyRows inserts the rows returned by a query in a table, and returns the
+// number of rows inserted. This is useful to move rows to an archive table, for
+// example:
+//
+//	n, err := sqlrange.CopyRows[Order](ctx, db, tx, sqlrange.Postgres,
+//	  `SELECT * FROM orders WHERE created_at < $1`, "orders_archive", nil, cutoff,
+//	)
+//
+// The columns are those inserted in the table, all the columns that the fields
+// of Row are mapped to are inserted when the list is empty. The fields are
+// resolved with the context hooks, see [WithTags] and [WithFieldResolver].
+//
+// The rows are inserted with multi-row INSERT statements as they are read from
+// the query, each statement having at most [CopyRowsMaxParams] parameters. Since
+// the query is still in progress when the statements are executed, q and e must
+// use different connections unless the driver supports executing statements
+// while reading the results of a query. When the source and target tables are
+// in the same database and no processing of the rows is needed, an INSERT ...
+// SELECT query is usually more efficient.
+func CopyRows[Row any](ctx context.Context, q Queryable, e Executable, dialect Dialect, selectQuery, insertTable string, columns []string, args ...any) (int64, error) {
+	hooks := hooksFrom(ctx)
+	fields := hooks.fields(reflect.TypeOf(new(Row)).Elem())
+
+	if len(columns) == 0 {
+		for _, f := range fields {
+			columns = append(columns, f.name)
+		}
+		if len(columns) == 0 {
+			return 0, fmt.Errorf("no columns to insert from values of type %s", reflect.TypeOf(new(Row)).Elem())
+		}
+	}
+
+	rowArgs, err := columnArgs[Row](fields, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	batchSize := max(CopyRowsMaxParams/len(columns), 1)
+	fullBatch := insertRowsQuery(dialect, insertTable, columns, batchSize)
+	batches := ChunkByParams(QueryContext[Row](ctx, q, selectQuery, args...), CopyRowsMaxParams,
+		func(Row) int { return len(columns) },
+	)
+
+	var n int64
+	for r, err := range ExecContext(ctx, e, fullBatch, batches,
+		ExecArgs(func(args []any, rows []Row) []any {
+			for _, row := range rows {
+				args = rowArgs(args, row)
+			}
+			return args
+		}),
+		ExecQuery(func(query string, rows []Row) string {
+			if len(rows) == batchSize {
+				return query
+			}
+			return insertRowsQuery(dialect, insertTable, columns, len(rows))
+		}),
+	) {
+		if err != nil {
+			return n, err
+		}
+		affected, err := r.RowsAffected()
+		if err != nil {
+			return n, err
+		}
+		n += affected
+	}
+	return n, nil
+}
+
+// columnArgs returns a function generating the query arguments of a row from
+// the fields mapped to the columns, in order.
+func columnArgs[Row any](fields []field, columns []string) (func([]any, Row) []any, error) {
+	indexes := make([][]int, len(columns))
+	fieldArgs := make([]func(reflect.Value) any, len(columns))
+	for i, column := range columns {
+		j := slices.IndexFunc(fields, func(f field) bool { return f.name == column })
+		if j < 0 {
+			return nil, fmt.Errorf("column %q not found", column)
+		}
+		arg, err := fieldArg(fields[j])
+		if err != nil {
+			return nil, err
+		}
+		indexes[i] = fields[j].field.Index
+		fieldArgs[i] = arg
+	}
+	return func(args []any, row Row) []any {
+		rowValue := reflect.ValueOf(row)
+		for i, index := range indexes {
+			args = append(args, fieldArgs[i](rowValue.FieldByIndex(index)))
+		}
+		return args
+	}, nil
+}
+
+// CopyRowsMaxParams is the maximum number of parameters of the INSERT
+// statements executed by [CopyRows]. It is the default limit of SQLite before
+// version 3.32, the lowest of the databases that the dialects of the package
+// support.
+const CopyRowsMaxParams = 999
+
+// Pipe streams the rows returned by a query through a transformation, and
+// executes a query on the destination with each of the results, for example to
+// migrate rows to a table with a different schema:
+//
+//	err := sqlrange.Pipe(ctx, src, `SELECT * FROM users`,
+//	  dst, `INSERT INTO accounts (id, email) VALUES ($1, $2)`,
+//	  func(u User) (Account, error) {
+//	    return Account{ID: u.ID, Email: strings.ToLower(u.Email)}, nil
+//	  },
+//	)
+//
+// The function composes [QueryContext], [Map], and [ExecContext], rows are
+// written as they are read without being held in memory. The arguments of the
+// destination query are generated from the fields of Out as done by default by
+// [ExecContext].
+//
+// The pipe is aborted by the first error of the query, the transformation, or
+// the execution of the destination query, which is returned by the function.
+// Since the source rows remain open while the destination query is executed,
+// src and dst must not be the same transaction or connection, unless the driver
+// supports executing queries while reading the results of another.
+func Pipe[In, Out any](ctx context.Context, src Queryable, srcQuery string, dst Executable, dstQuery string, transform func(In) (Out, error)) error {
+	return Drain(ExecContext(ctx, dst, dstQuery, Map(QueryContext[In](ctx, src, srcQuery), transform)))
+}
+
+// InsertProgress inserts the rows of a sequence in a table with multi-row
+// INSERT statements of up to batchSize rows, and returns the number of rows
+// inserted. The progress function is called after each batch with the number
+// of rows inserted so far, for example to update a progress bar:
+//
+//	n, err := sqlrange.InsertProgress(ctx, db, sqlrange.Postgres, "events", events, 1000,
+//	  func(n int64) { bar.Set(n) },
+//	)
+//
+// The columns are those that the fields of Row are mapped to, resolved with the
+// context hooks (see [WithTags] and [WithFieldResolver]), and the function
+// returns an error if there are none. The progress function may be nil.
+//
+// The context is checked before each batch, so canceling it stops the insert
+// cleanly between two batches, in which case the function returns the number
+// of rows inserted by the previous batches and the error of the context. When
+// executing a batch fails, the function returns the number of rows inserted by
+// the previous batches and the error. Note that each batch is committed on its
+// own unless e is a transaction, in which case the rows are only committed with
+// the transaction.
+func InsertProgress[Row any](ctx context.Context, e Executable, dialect Dialect, table string, seq iter.Seq2[Row, error], batchSize int, progress func(int64)) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	hooks := hooksFrom(ctx)
+	rowType := reflect.TypeOf(new(Row)).Elem()
+	fields := hooks.fields(rowType)
+
+	var columns []string
+	for _, f := range fields {
+		columns = append(columns, f.name)
+	}
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("no columns to insert from values of type %s", rowType)
+	}
+
+	rowArgs, err := columnArgs[Row](fields, columns)
+	if err != nil {
+		return 0, err
+	}
+	fullBatch := insertRowsQuery(dialect, table, columns, batchSize)
+
+	// The results of each batch are yielded before the next batch is read
+	// from the sequence, so pending is the size of the batch of each result.
+	batches := ChunkByParams(seq, batchSize, func(Row) int { return 1 })
+	var total int64
+	var pending int
+
+	input := func(yield func([]Row, error) bool) {
+		for batch, err := range batches {
+			if err == nil {
+				err = ctx.Err()
+			}
+			pending = len(batch)
+			if !yield(batch, err) || err != nil {
+				return
+			}
+		}
+	}
+
+	for _, err := range ExecContext(ctx, e, fullBatch, input,
+		ExecArgs(func(args []any, rows []Row) []any {
+			for _, row := range rows {
+				args = rowArgs(args, row)
+			}
+			return args
+		}),
+		ExecQuery(func(query string, rows []Row) string {
+			if len(rows) == batchSize {
+				return query
+			}
+			return insertRowsQuery(dialect, table, columns, len(rows))
+		}),
+	) {
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+			}
+			return total, err
+		}
+		total += int64(pending)
+		if progress != nil {
+			progress(total)
+		}
+	}
+	return total, nil
+}
+
+// InsertReturning inserts the rows of a sequence in a table, and yields the
+// rows as stored in the database, including the values generated for the key
+// column and columns with defaults, for example:
+//
+//	for user, err := range sqlrange.InsertReturning(ctx, db, db, sqlrange.Postgres, "users", "id", users) {
+//	  if err != nil {
+//	    ...
+//	  }
+//	  log.Printf("created user %d", user.ID)
+//	}
+//
+// The key column is excluded from the inserted columns so the database
+// generates its value. The columns are those that the fields of Row are mapped
+// to, resolved with the context hooks (see [WithTags] and [WithFieldResolver]).
+// When the dialect supports it, each row is inserted by a query on q with a
+// RETURNING clause listing all the columns. Otherwise, as on MySQL, the row is inserted with e and read
+// back from the table with q using the id reported by [sql.Result.LastInsertId],
+// which requires the key column to be an auto-incremented integer.
+//
+// The iteration stops at the first error, whether it came from the input
+// sequence or from one of the queries.
+func InsertReturning[Row any](ctx context.Context, q Queryable, e Executable, dialect Dialect, table, key string, seq iter.Seq2[Row, error]) iter.Seq2[Row, error] {
+	hooks := hooksFrom(ctx)
+	rowType := reflect.TypeOf(new(Row)).Elem()
+	fields := hooks.fields(rowType)
+
+	var columns, columnList []string
+	for _, f := range fields {
+		if f.name != key {
+			columns = append(columns, f.name)
+		}
+		columnList = append(columnList, dialect.quote(f.name))
+	}
+
+	rowArgs, err := columnArgs[Row](fields, columns)
+	if err == nil && len(columns) == 0 {
+		err = fmt.Errorf("no columns to insert from values of type %s", rowType)
+	}
+	if err != nil {
+		return func(yield func(Row, error) bool) {
+			var zero Row
+			yield(zero, err)
+		}
+	}
+
+	insert := insertQuery(dialect, table, columns)
+	returning := strings.Join(columnList, ", ")
+
+	if dialect.Returning {
+		return QueryEach[Row, Row](ctx, q, insert+" RETURNING "+returning, seq,
+			func(row Row) []any { return rowArgs(nil, row) },
+		)
+	}
+
+	selectQuery := "SELECT " + returning +
+		" FROM " + dialect.quoteTable(table) +
+		" WHERE " + dialect.quote(key) + " = " + dialect.Placeholder.Nth(1)
+
+	return func(yield func(Row, error) bool) {
+		var zero Row
+		for r, err := range ExecContext(ctx, e, insert, seq, ExecArgs(rowArgs)) {
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			id, err := r.LastInsertId()
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			found := false
+			for row, err := range QueryContext[Row](ctx, q, selectQuery, id) {
+				if !yield(row, err) || err != nil {
+					return
+				}
+				found = true
+			}
+			if !found {
+				yield(zero, sql.ErrNoRows)
+				return
+			}
+		}
+	}
+}
+
+// Scan returns a sequence of rows from a [sql.Rows] value.
+//
+// The returned function automatically closes the rows passed as argument when
+// it completes its iteration, unless the [ScanNoClose] option is used.
+//
+// A typical use of Scan is:
+//
+//	rows, err := db.QueryContext(ctx, query, args...)
+//	if err != nil {
+//	  ...
+//	}
+//	for row, err := range sqlrange.Scan[RowType](rows) {
+//	  if err != nil {
+//	    ...
+//	  }
+//	  ...
+//	}
+//
+// Scan uses reflection to map the columns of the rows to the fields of the
+// struct passed as argument. The mapping is done by matching the name of the
+// columns with the name of the fields. The name of the columns is taken from
+// the "sql" tag of the fields. For example:
+//
+//	type Row struct {
+//	  ID   int64  `sql:"id"`
+//	  Name string `sql:"name"`
+//	}
+//
+// The columns are matched by the names reported by the driver, which for
+// computed values such as constants or function calls are usually the text of
+// the expressions, and vary between databases. Queries should name computed
+// columns with an alias to map them to fields, for example:
+//
+//	type Row struct {
+//	  Answer int64 `sql:"answer"`
+//	  Count  int64 `sql:"count"`
+//	}
+//
+//	SELECT 42 AS answer, COUNT(*) AS count FROM table
+//
+// The fields of the struct that do not have a "sql" tag are ignored, and so are
+// the columns that are not mapped to any field, which allows scanning the
+// result of queries like "SELECT *" into structs declaring only some of the
+// columns. Tagged fields of struct types, such as types implementing
+// [sql.Scanner], are mapped to a single column and scanned as a whole, only the
+// fields of embedded structs are mapped to columns of their own.
+//
+// Options may follow the column name in the "sql" tag, separated by commas.
+// The "enum" option validates that the scanned values were registered with
+// [RegisterEnum] for the type of the field. The "sentinel" option scans the
+// values registered with [RegisterNullSentinel] as nil pointers. The "extra"
+// option designates a field of type map[string]any, which receives the values
+// of the columns that are not mapped to any other field, for example:
+//
+//	type Row struct {
+//	  ID    int64          `sql:"id"`
+//	  Extra map[string]any `sql:",extra"`
+//	}
+//
+// The "jsonpath" option extracts the value of a field from a json document held
+// in the column, which is decoded once for all the fields extracted from it.
+// The path starts with "$" followed by object keys prefixed with a dot and
+// array indexes in brackets. Fields whose path does not exist in the document,
+// or whose column is NULL, are left to their zero value. For example:
+//
+//	type Row struct {
+//	  Name string `sql:"doc,jsonpath=$.user.name"`
+//	  City string `sql:"doc,jsonpath=$.user.addresses[0].city"`
+//	}
+//
+// The "alias" option gives alternative names of the column that the field is
+// mapped to, which are tried in order when the result set does not contain a
+// column with the name of the field. This is useful when the schemas of
+// different databases have diverged, for example:
+//
+//	type Row struct {
+//	  Email string `sql:"email,alias=email_address,alias=mail"`
+//	}
+//
+// Fields of type [json.RawMessage] receive a copy of the raw bytes of json
+// columns, which remain valid after the iteration moves to the next row.
+// Boolean fields accept the integers 0 and 1, and BIT(1) values made of a
+// single byte, which are used by databases without a native boolean type.
+// Fields of types registered with [RegisterConverter], or [RegisterTagConverter]
+// for one of their tag options, are scanned by the scan function of their
+// converter. Fields of types implementing [encoding.TextUnmarshaler] but not
+// [sql.Scanner], such as [net.IP], are decoded from the text of the columns,
+// and they are encoded with [encoding.TextMarshaler] when passed as arguments
+// to [Exec] and [ExecContext].
+//
+// The behavior of Scan can be configured by passing options of type
+// [ScanOption], which may also be passed among the arguments of [Query] and
+// [QueryContext].
+//
+// The mapping of columns to struct fields is computed each time the iteration
+// starts, from the columns of the current result set. When consuming multiple
+// result sets with the [ScanNoClose] option, each call to Scan after moving to
+// the next result set maps the columns of that set, which may differ in number
+// or order from the previous ones.
+//
+// The type parameter may also be a map with string keys, in which case each row
+// is returned as a new map associating the column names with their values,
+// converted to the value type of the map, for example map[string]any to retain
+// the values returned by the driver, or map[string]string to convert them all
+// to strings. The iteration yields an error if a value cannot be converted.
+// The scan options and tag options configuring the mapping of columns to struct
+// fields do not apply to maps.
+//
+// The type parameter may be an anonymous struct, which is convenient for ad-hoc
+// queries. Anonymous struct types with the same fields and tags are identical,
+// wherever they are declared, and share the same mapping:
+//
+//	for row, err := range sqlrange.Query[struct {
+//	  ID   int64  `sql:"id"`
+//	  Name string `sql:"name"`
+//	}](db, `SELECT id, name FROM users`) {
+//	  ...
+//	}
+//
+// Ranging over the returned function will panic if the type parameter is not a
+// struct or a map.
+func Scan[Row any](rows *sql.Rows, opts ...ScanOption) iter.Seq2[Row, error] {
+	return ScanContext[Row](context.Background(), rows, opts...)
+}
+
+// ScanContext is like [Scan] but it checks for cancellation of the context
+// before moving to each row, so the iteration ends promptly with the error of
+// the context when it is canceled, even if the driver has not noticed it yet.
+// This bounds the duration of the iteration when the program consumes the rows
+// slowly.
+func ScanContext[Row any](ctx context.Context, rows *sql.Rows, opts ...ScanOption) iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) { scan(ctx, yield, rows, newScanOptions(opts)) }
+}
+
+// QueryValues is like [QueryContext] but it returns the rows as slices of values
+// in the order of the columns, see [ScanValues].
+func QueryValues(ctx context.Context, q Queryable, query string, args ...any) iter.Seq2[[]any, error] {
+	return func(yield func([]any, error) bool) {
+		hooks := hooksFrom(ctx)
+
+		query, err := hooks.query(ctx, query)
+		if err != nil {
+			hooks.incErrors()
+			yield(nil, err)
+			return
+		}
+
+		if err := hooks.validate(query, args); err != nil {
+			hooks.incErrors()
+			yield(nil, err)
+			return
+		}
+
+		hooks.incQueries()
+		start := hooks.start()
+		rows, err := q.QueryContext(ctx, query, args...)
+		hooks.observe(query, start, err)
+		if err != nil {
+			hooks.incErrors()
+			yield(nil, err)
+		} else {
+			scanValues(ctx, yield, rows)
+		}
+	}
+}
+
+// ScanValues returns a sequence of the rows of a [sql.Rows] value as slices of
+// values in the order of the columns, which is useful to display the results of
+// arbitrary queries, for example in a table:
+//
+//	columns, err := rows.Columns()
+//	if err != nil {
+//	  ...
+//	}
+//	for values, err := range sqlrange.ScanValues(rows) {
+//	  if err != nil {
+//	    ...
+//	  }
+//	  for i, value := range values {
+//	    fmt.Printf("%s=%v\n", columns[i], value)
+//	  }
+//	}
+//
+// The values are those returned by the driver, with NULL columns represented as
+// nil. A new slice is allocated for each row, and byte slices are copied, so
+// the program may retain them after the iteration moves to the next row.
+//
+// The returned function automatically closes the rows when it completes its
+// iteration.
+func ScanValues(rows *sql.Rows) iter.Seq2[[]any, error] {
+	return func(yield func([]any, error) bool) { scanValues(context.Background(), yield, rows) }
+}
+
+func scanValues(ctx context.Context, yield func([]any, error) bool, rows *sql.Rows) {
+	defer rows.Close()
+	hooks := hooksFrom(ctx)
+	yield = countYield(&hooks, yield, true)
+
+	columns, err := rows.Columns()
+	if err != nil {
+		yield(nil, err)
+		return
+	}
+
+	scanArgs := make([]any, len(columns))
+	for {
+		if err := ctx.Err(); err != nil {
+			yield(nil, err)
+			return
+		}
+		if !rows.Next() {
+			break
+		}
+		values := make([]any, len(columns))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			yield(nil, err)
+			return
+		}
+		if !yield(values, nil) {
+			return
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		yield(nil, err)
+	}
+}
+
+// ScanChan is like [ScanContext] but it scans the rows in a goroutine, and sends
+// them to the returned channel of rows, which bridges range functions with
+// concurrency patterns based on channels:
+//
+//	rowsCh, errCh := sqlrange.ScanChan[RowType](ctx, rows)
+//	for row := range rowsCh {
+//	  ...
+//	}
+//	if err := <-errCh; err != nil {
+//	  ...
+//	}
+//
+// When the scan completes, the error which terminated it is sent to the error
+// channel, if any, then both channels are closed. The program must cancel the
+// context if it stops receiving rows before the end of the results, which
+// terminates the goroutine with the error of the context.
+func ScanChan[Row any](ctx context.Context, rows *sql.Rows, opts ...ScanOption) (<-chan Row, <-chan error) {
+	rowsCh := make(chan Row)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(errCh)
+		defer close(rowsCh)
+
+		for row, err := range ScanContext[Row](ctx, rows, opts...) {
+			if err != nil {
+				errCh <- err
+				return
+			}
+			select {
+			case rowsCh <- row:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return rowsCh, errCh
+}
+
+func scan[Row any](ctx context.Context, yield func(Row, error) bool, rows *sql.Rows, options *scanOptions) {
+	hooks := hooksFrom(ctx)
+	yield = countYield(&hooks, yield, true)
+
+	if !options.noClose {
+		defer rows.Close()
+	}
+	var zero Row
+
+	columns, err := rows.Columns()
+	if err != nil {
+		yield(zero, err)
+		return
+	}
+	if options.trimColumns {
+		columns = trimColumns(columns)
+	}
+	if reflect.TypeOf(new(Row)).Elem().Kind() == reflect.Map {
+		scanMaps(ctx, yield, rows, columns, options)
+		return
+	}
+
+	scanArgs := make([]any, len(columns))
+	row := new(Row)
+	val := reflect.ValueOf(row).Elem()
+
+	// afterScan is a list of functions invoked after scanning each row, which
+	// apply the options of struct field tags and scan options.
+	var afterScan []func() error
+
+	fields := hooks.fields(val.Type())
+	// columnFields is the list of fields that the columns are mapped to, it
+	// is used to describe the errors.
+	columnFields := make([]reflect.StructField, len(columns))
+
+	for _, f := range fields {
+		if options.skip(f.name) {
+			continue
+		}
+		if columnIndex := f.columnIndex(columns); columnIndex >= 0 {
+			fieldValue := val.FieldByIndex(f.field.Index)
+			scanArgs[columnIndex] = options.dest(fieldValue)
+			columnFields[columnIndex] = f.field
+
+			if options.precisionWarning != nil && isFloat(fieldValue.Kind()) && converterOf(fieldValue.Type()) == nil {
+				scanArgs[columnIndex] = precisionCheck{columns[columnIndex], fieldValue, scanArgs[columnIndex], options.precisionWarning}
+			}
+
+			if c := tagConverterOf(f); c != nil {
+				scanArgs[columnIndex] = c.dest(fieldValue)
+			}
+
+			if f.options.contains("sentinel") {
+				s, err := sentinelOf(f.name, fieldValue.Type())
+				if err != nil {
+					yield(zero, err)
+					return
+				}
+				scanArgs[columnIndex] = s.dest(fieldValue)
+			}
+
+			if f.options.contains("enum") {
+				check, err := enumCheck(f.name, fieldValue)
+				if err != nil {
+					yield(zero, err)
+					return
+				}
+				afterScan = append(afterScan, check)
+			}
+		}
+	}
+
+	if err := options.discardUnmapped(fields, scanArgs); err != nil {
+		yield(zero, err)
+		return
+	}
+
+	if fn, err := options.scanCoalesce(rows, columns, val, fields, scanArgs); err != nil {
+		yield(zero, err)
+		return
+	} else if fn != nil {
+		// The fields must be assigned before the validations apply.
+		afterScan = slices.Insert(afterScan, 0, fn)
+	}
+
+	if options.nullStructs {
+		if fn := scanNullStructs(rows, columns, val, scanArgs, &hooks); fn != nil {
+			afterScan = append(afterScan, fn)
+		}
+	}
+
+	if options.rawBytes {
+		if fn := scanRawBytes(scanArgs); fn != nil {
+			// The string fields must be assigned before the validations
+			// apply.
+			afterScan = slices.Insert(afterScan, 0, fn)
+		}
+	}
+
+	if options.timeLocation != nil {
+		if fn := scanTimeLocation(scanArgs, options.timeLocation); fn != nil {
+			afterScan = append(afterScan, fn)
+		}
+	}
+
+	if fn, err := scanJSONPaths(rows, columns, val, scanArgs, &hooks); err != nil {
+		yield(zero, err)
+		return
+	} else if fn != nil {
+		afterScan = append(afterScan, fn)
+	}
+
+	if fn, err := scanCombines(rows, columns, val, fields, scanArgs, options.combines); err != nil {
+		yield(zero, err)
+		return
+	} else if fn != nil {
+		afterScan = append(afterScan, fn)
+	}
+
+	if fn, err := options.setDefaults(columns, val, fields); err != nil {
+		yield(zero, err)
+		return
+	} else if fn != nil {
+		afterScan = append(afterScan, fn)
+	}
+
+	if fn, err := scanExtra(columns, val, scanArgs, &hooks); err != nil {
+		yield(zero, err)
+		return
+	} else if fn != nil {
+		afterScan = append(afterScan, fn)
+	}
+
+	// The columns which are still not mapped to any field, for example when
+	// using "SELECT *" with a struct that declares only some of the columns,
+	// must have a destination for rows.Scan to accept the arguments.
+	for i := range scanArgs {
+		if scanArgs[i] == nil {
+			scanArgs[i] = discard{}
+		}
+	}
+
+	// The sizes of the values are checked before the row is scanned, so the
+	// values exceeding the limit are never copied.
+	var checkSizes func() error
+	if options.maxBytes > 0 {
+		checkSizes = scanMaxBytes(rows, columns, options.maxBytes)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			yield(zero, err)
+			return
+		}
+		if !rows.Next() {
+			break
+		}
+		if checkSizes != nil {
+			if err := checkSizes(); err != nil {
+				yield(zero, err)
+				return
+			}
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			yield(zero, scanError(rows, columns, scanArgs, columnFields, err))
+			return
+		}
+		for _, check := range afterScan {
+			if err := check(); err != nil {
+				yield(zero, err)
+				return
+			}
+		}
+		if !yield(*row, nil) {
+			return
+		}
+		*row = zero
+	}
+
+	if err := rows.Err(); err != nil {
+		yield(zero, err)
+	}
+}
+
+// scanError is called when scanning a row failed, it checks whether the error
+// was caused by the driver changing the shape of the result set after the
+// columns were read, and returns a more descriptive error if it did.
+//
+// Otherwise, the columns are scanned again individually to find the one which
+// caused the error, so it can be reported along with the field that it was
+// mapped to.
+func scanError(rows *sql.Rows, columns []string, scanArgs []any, columnFields []reflect.StructField, err error) error {
+	if current, _ := rows.Columns(); current != nil && len(current) != len(columns) {
+		return fmt.Errorf("result set changed from %d to %d columns during the scan: %w", len(columns), len(current), err)
+	}
+
+	rescanArgs := make([]any, len(scanArgs))
+	for i := range rescanArgs {
+		rescanArgs[i] = discard{}
+	}
+	for i, arg := range scanArgs {
+		rescanArgs[i] = arg
+		columnErr := rows.Scan(rescanArgs...)
+		rescanArgs[i] = discard{}
+		if columnErr == nil {
+			continue
+		}
+		// Remove the "sql: Scan error on column index ..." prefix, since the
+		// error is wrapped with a more descriptive message.
+		if cause := errors.Unwrap(columnErr); cause != nil {
+			columnErr = cause
+		}
+		if f := columnFields[i]; f.Name != "" {
+			return fmt.Errorf("scanning column %q into field %s of type %s: %w", columns[i], f.Name, f.Type, columnErr)
+		}
+		return fmt.Errorf("scanning column %q: %w", columns[i], columnErr)
+	}
+	return err
+}
+
+// CompileScanner returns a function which scans the current row of a
+// [sql.Rows] value into a Row, for result sets made of the given columns.
+//
+// The mapping of columns to struct fields is computed once, and the returned
+// function reuses its scan destinations when it is called repeatedly with the
+// same Row pointer, which allows programs to scan rows without allocating
+// memory on the heap in the steady state. A typical use of CompileScanner is:
+//
+//	columns, err := rows.Columns()
+//	if err != nil {
+//	  ...
+//	}
+//	scan := sqlrange.CompileScanner[RowType](columns)
+//	row := new(RowType)
+//	for rows.Next() {
+//	  if err := scan(rows, row); err != nil {
+//	    ...
+//	  }
+//	  ...
+//	}
+//
+// The columns must be listed in the order that they appear in the result set.
+// Columns that do not match any of the struct fields are discarded. When the
+// rows have multiple result sets, a new scanner must be compiled for each set
+// which has different columns.
+//
+// The Row value is reset to its zero value before scanning each row, so fields
+// that are not mapped to any of the columns never retain values from a
+// previous use of the Row value.
+//
+// The returned function is not safe to use concurrently from multiple
+// goroutines.
+func CompileScanner[Row any](columns []string) func(*sql.Rows, *Row) error {
+	mapper := NewMapper[Row](columns)
+	scanArgs := make([]any, len(columns))
+	var scanRow *Row
+
+	return func(rows *sql.Rows, row *Row) error {
+		if row != scanRow {
+			mapper.scanArgs(scanArgs, row)
+			scanRow = row
+		}
+		var zero Row
+		*row = zero
+		return rows.Scan(scanArgs...)
+	}
+}
+
+// Mapper is a precomputed mapping of the columns of result sets to the fields
+// of a Row type, which allows scanning result sets of identical shape without
+// looking up their columns and recomputing the mapping each time, see
+// [ScanPrepared].
+//
+// Mapper values are immutable, they are safe to use concurrently from multiple
+// goroutines.
+type Mapper[Row any] struct {
+	columns []string
+	fields  []reflect.StructField
+}
+
+// NewMapper returns a mapping of the given columns to the fields of Row.
+//
+// As with [CompileScanner], the columns must be listed in the order that they
+// appear in the result sets, and columns which do not match any of the struct
+// fields are discarded.
+func NewMapper[Row any](columns []string) *Mapper[Row] {
+	m := &Mapper[Row]{
+		columns: slices.Clone(columns),
+		fields:  make([]reflect.StructField, len(columns)),
+	}
+	for columnName, structField := range Fields(reflect.TypeOf(new(Row)).Elem()) {
+		if columnIndex := slices.Index(columns, columnName); columnIndex >= 0 {
+			m.fields[columnIndex] = structField
+		}
+	}
+	return m
+}
+
+// Columns returns the list of columns of the mapping.
+func (m *Mapper[Row]) Columns() []string {
+	return slices.Clone(m.columns)
+}
+
+// scanArgs sets the destinations of the columns to the fields of row.
+func (m *Mapper[Row]) scanArgs(scanArgs []any, row *Row) {
+	val := reflect.ValueOf(row).Elem()
+	for i, f := range m.fields {
+		if f.Index == nil {
+			scanArgs[i] = discard{}
+		} else {
+			scanArgs[i] = scanDest(val.FieldByIndex(f.Index))
+		}
+	}
+}
+
+// ScanPrepared is like [Scan] but it uses a precomputed mapping of the columns
+// to the fields of Row, which avoids the cost of retrieving the columns and
+// mapping them to fields when scanning many result sets of the same shape, for
+// example when executing small queries repeatedly:
+//
+//	mapper := sqlrange.NewMapper[User]([]string{"id", "name"})
+//	for _, id := range ids {
+//	  rows, err := stmt.QueryContext(ctx, id)
+//	  if err != nil {
+//	    ...
+//	  }
+//	  for user, err := range sqlrange.ScanPrepared(mapper, rows) {
+//	    ...
+//	  }
+//	}
+//
+// The columns of the rows are not verified, the program must ensure that they
+// match those of the mapper, or the iteration yields an error when the number
+// of columns differs, or produces values from the wrong columns when they are
+// in a different order. As with [CompileScanner], scan options and the options
+// of struct field tags do not apply.
+//
+// The returned function automatically closes the rows when it completes its
+// iteration.
+func ScanPrepared[Row any](m *Mapper[Row], rows *sql.Rows) iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		defer rows.Close()
+		var zero Row
+
+		row := new(Row)
+		scanArgs := make([]any, len(m.columns))
+		m.scanArgs(scanArgs, row)
+
+		for rows.Next() {
+			if err := rows.Scan(scanArgs...); err != nil {
+				yield(zero, scanError(rows, m.columns, scanArgs, m.fields, err))
+				return
+			}
+			if !yield(*row, nil) {
+				return
+			}
+			*row = zero
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// scanDest returns the destination passed to [sql.Rows.Scan] for a struct
+// field.
+func scanDest(fieldValue reflect.Value) any {
+	if c := converterOf(fieldValue.Type()); c != nil {
+		return c.dest(fieldValue)
+	}
+	switch fieldValue.Type() {
+	case rawMessageType:
+		return (*rawMessage)(fieldValue.Addr().Interface().(*json.RawMessage))
+	}
+	if isTextType(fieldValue.Type(), textUnmarshalerType) && !isValueType(fieldValue.Type()) {
+		return textValue{fieldValue}
+	}
+	switch fieldValue.Kind() {
+	case reflect.Bool:
+		return (*boolValue)(fieldValue.Addr().Convert(boolPointerType).Interface().(*bool))
+	}
+	return fieldValue.Addr().Interface()
+}
+
+// fieldArg returns the function converting the value of a struct field to the
+// argument passed to [Executable.ExecContext], accounting for its tag options.
+func fieldArg(f field) (func(reflect.Value) any, error) {
+	if c := tagConverterOf(f); c != nil {
+		return c.arg, nil
+	}
+	if !f.options.contains("sentinel") {
+		return execArg, nil
+	}
+	s, err := sentinelOf(f.name, f.field.Type)
+	if err != nil {
+		return nil, err
+	}
+	return s.arg, nil
+}
+
+// execArg returns the argument passed to [Executable.ExecContext] for a struct
+// field.
+func execArg(fieldValue reflect.Value) any {
+	if c := converterOf(fieldValue.Type()); c != nil {
+		return c.arg(fieldValue)
+	}
+	switch fieldValue.Type() {
+	case rawMessageType:
+		return []byte(fieldValue.Interface().(json.RawMessage))
+	}
+	if isTextType(fieldValue.Type(), textMarshalerType) && !fieldValue.Type().Implements(valuerType) {
+		return textArg{fieldValue.Interface().(encoding.TextMarshaler)}
+	}
+	return fieldValue.Interface()
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// rawMessage is a [sql.Scanner] capturing the raw bytes of json columns into
+// [json.RawMessage] fields.
+//
+// The bytes are always copied so the values remain valid after the next row is
+// scanned, which matters since drivers may reuse their buffers across rows.
+type rawMessage json.RawMessage
+
+func (m *rawMessage) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+	case []byte:
+		*m = append((*m)[:0:0], v...)
+	case string:
+		*m = append((*m)[:0:0], v...)
+	default:
+		return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type json.RawMessage", src)
+	}
+	return nil
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isTextType reports whether t is converted to and from text columns by
+// implementing the given interface of the encoding package, with either a
+// value or pointer receiver.
+//
+// Booleans, numbers, strings, and time.Time are excluded since they are
+// natively supported by database/sql, even if they implement the interface, as
+// well as pointers, which database/sql allocates before scanning their element.
+func isTextType(t, iface reflect.Type) bool {
+	switch k := t.Kind(); {
+	case t == timeType, k == reflect.Bool, k == reflect.String, isNumber(k):
+		return false
+	case k == reflect.Pointer, k == reflect.Interface:
+		return false
+	}
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// textValue is a [sql.Scanner] decoding the values of text columns into fields
+// of types implementing [encoding.TextUnmarshaler], such as [net.IP].
+type textValue struct{ value reflect.Value }
+
+func (v textValue) Scan(src any) error {
+	var text []byte
+	switch s := src.(type) {
+	case nil:
+		v.value.SetZero()
+		return nil
+	case []byte:
+		text = s
+	case string:
+		text = []byte(s)
+	default:
+		return fmt.Errorf("converting driver.Value type %T (%v) to %s is unsupported", src, src, v.value.Type())
+	}
+	return v.value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(text)
+}
+
+// textArg is a [driver.Valuer] encoding query arguments of types implementing
+// [encoding.TextMarshaler] as text.
+type textArg struct{ m encoding.TextMarshaler }
+
+func (a textArg) Value() (driver.Value, error) {
+	text, err := a.m.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return string(text), nil
+}
+
+var boolPointerType = reflect.TypeOf((*bool)(nil))
+
+// boolValue is a [sql.Scanner] normalizing the representations of booleans
+// used by databases which do not have a native boolean type, such as MySQL
+// returning BOOLEAN columns as TINYINT, and BIT(1) columns as a single byte.
+type boolValue bool
+
+func (b *boolValue) Scan(src any) error {
+	switch v := src.(type) {
+	case bool:
+		*b = boolValue(v)
+		return nil
+	case int64:
+		if v == 0 || v == 1 {
+			*b = v == 1
+			return nil
+		}
+	case []byte:
+		if len(v) == 1 && (v[0] == 0 || v[0] == 1) {
+			*b = v[0] == 1
+			return nil
+		}
+		return b.parse(string(v))
+	case string:
+		return b.parse(v)
+	case nil:
+		return errors.New("converting NULL to bool is unsupported")
+	}
+	return fmt.Errorf("converting driver.Value type %T (%v) to bool is unsupported", src, src)
+}
+
+func (b *boolValue) parse(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("converting %q to bool: %w", s, err)
+	}
+	*b = boolValue(v)
+	return nil
+}
+
+// discard is a [sql.Scanner] used as destination for columns that are not
+// mapped to any struct field.
+type discard struct{}
+
+func (discard) Scan(any) error { return nil }
+
+// Fields returns a sequence of the fields of a struct type that have a "sql"
+// tag.
+//
+// The sequence yields the column names that the fields are mapped to, which
+// are the part of the "sql" tags preceding the first comma, if any; the rest
+// of the tags are a comma-separated list of options. Fields with the "extra"
+// or "jsonpath" tag options are not mapped to a column of their own and are
+// therefore not included.
+//
+// The fields of embedded structs are included as if they were declared in the
+// outer struct, unless the embedded type implements [sql.Scanner] or
+// [driver.Valuer] and the embedded field has a "sql" tag, in which case it is
+// mapped to a column as a single field. Fields with the tag `sql:"-"` are
+// excluded, which also applies to embedded structs.
+func Fields(t reflect.Type) iter.Seq2[string, reflect.StructField] {
+	return func(yield func(string, reflect.StructField) bool) {
+		for _, f := range cachedFieldsOf(t) {
+			if !yield(f.name, f.field) {
+				return
+			}
+		}
+	}
+}
+
+// NumColumns returns the number of columns that the fields of Row are mapped to,
+// which is the number of fields yielded by [Fields]. This is useful to pre-size
+// buffers when generating queries, for example the placeholders of batch
+// inserts.
+func NumColumns[Row any]() int {
+	return len(cachedFieldsOf(reflect.TypeOf(new(Row)).Elem()))
+}
+
+// FieldColumns returns a map of the names of the fields of Row to the names of
+// the columns that they are mapped to, as defined by [Fields]. This is useful to
+// code generators, which can reference columns without string literals.
+//
+// The fields of embedded structs are keyed by their own name, which is the name
+// that they are promoted to in the Row type.
+func FieldColumns[Row any]() map[string]string {
+	fields := cachedFieldsOf(reflect.TypeOf(new(Row)).Elem())
+	columns := make(map[string]string, len(fields))
+	for _, f := range fields {
+		columns[f.field.Name] = f.name
+	}
+	return columns
+}
+
+// FieldsSorted is like [Fields] but the sequence yields the fields sorted by
+// column name instead of the order they appear in the struct.
+//
+// This is useful to generate SQL queries which do not depend on the order that
+// fields are declared in, and remain stable when the struct is refactored.
+// Fields mapped to the same column name retain their relative order.
+func FieldsSorted(t reflect.Type) iter.Seq2[string, reflect.StructField] {
+	return func(yield func(string, reflect.StructField) bool) {
+		fields := slices.Clone(cachedFieldsOf(t))
+		slices.SortStableFunc(fields, func(a, b field) int {
+			return strings.Compare(a.name, b.name)
+		})
+		for _, f := range fields {
+			if !yield(f.name, f.field) {
+				return
+			}
+		}
+	}
+}
+
+type field struct {
+	name    string
+	options tagOptions
+	field   reflect.StructField
+}
+
+// columnIndex returns the index of the column that the field is mapped to in a
+// result set, trying the aliases of the field in order when the column with
+// its name is absent, or -1 if none of the columns match.
+func (f field) columnIndex(columns []string) int {
+	if columnIndex := slices.Index(columns, f.name); columnIndex >= 0 {
+		return columnIndex
+	}
+	for alias := range f.options.values("alias") {
+		if columnIndex := slices.Index(columns, alias); columnIndex >= 0 {
+			return columnIndex
+		}
+	}
+	return -1
+}
+
+// tagOptions is the comma-separated list of options following the column name
+// in a "sql" struct tag.
+type tagOptions string
+
+// contains reports whether the list of options contains the given option.
+func (o tagOptions) contains(option string) bool {
+	for s := string(o); s != ""; {
+		var name string
+		name, s, _ = strings.Cut(s, ",")
+		if name == option {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the first value of an option in the list, and whether the
+// option was found.
+func (o tagOptions) value(option string) (string, bool) {
+	for value := range o.values(option) {
+		return value, true
+	}
+	return "", false
+}
+
+// values returns the sequence of values of an option in the list, which are
+// written as "option=value".
+func (o tagOptions) values(option string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for s := string(o); s != ""; {
+			var opt string
+			opt, s, _ = strings.Cut(s, ",")
+			if name, value, ok := strings.Cut(opt, "="); ok && name == option {
+				if !yield(value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func parseTag(tag string) (string, tagOptions) {
+	name, options, _ := strings.Cut(tag, ",")
+	return name, tagOptions(options)
+}
+
+var cachedFields atomic.Value // map[fieldsKey][]field
+
+// fieldsKey is the key of the cache of struct fields, the tags are the keys of
+// the struct tags looked up to map fields to columns, separated by zero bytes.
+type fieldsKey struct {
+	t    reflect.Type
+	tags string
+}
+
+// defaultTags is the list of struct tag keys used when the context does not
+// configure them with WithTags.
+var defaultTags = []string{"sql"}
+
+// ResetFieldsCache clears the cache of the mapping of struct fields to columns,
+// which the package maintains for each type passed to its functions, so the
+// memory retained by the entries of types which are no longer used can be
+// reclaimed. This is useful in tests and tools creating many types at runtime,
+// for example with [reflect.StructOf].
+//
+// The function may be called concurrently with other functions of the package,
+// the mappings are recomputed when the types are used again.
+func ResetFieldsCache() {
+	cachedFields.Store(map[fieldsKey][]field{})
+}
+
+func cachedFieldsOf(t reflect.Type) []field {
+	return cachedFieldsOfTags(t, defaultTags)
+}
+
+func cachedFieldsOfTags(t reflect.Type, tags []string) []field {
+	key := fieldsKey{t, strings.Join(tags, "\x00")}
+	cache, _ := cachedFields.Load().(map[fieldsKey][]field)
+
+	fields, ok := cache[key]
+	if !ok {
+		fields = appendFields(nil, t, nil, tags)
+
+		newCache := make(map[fieldsKey][]field, len(cache)+1)
+		for k, v := range cache {
+			newCache[k] = v
+		}
+		newCache[key] = fields
+		cachedFields.Store(newCache)
+	}
+
+	return fields
+}
+
+// lookupTag returns the value of the first of the tag keys present in a struct
+// tag.
+func lookupTag(tag reflect.StructTag, keys []string) (string, bool) {
+	for _, key := range keys {
+		if s, ok := tag.Lookup(key); ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// isValueType reports whether values of type t convert themselves to and from
+// column values, in which case embedded fields of that type are mapped to a
+// column instead of having their own fields flattened into the Row type.
+func isValueType(t reflect.Type) bool {
+	return t.Implements(scannerType) || reflect.PointerTo(t).Implements(scannerType) || t.Implements(valuerType)
+}
+
+func appendFields(fields []field, t reflect.Type, index []int, tags []string) []field {
+	for i, n := 0, t.NumField(); i < n; i++ {
+		if f := t.Field(i); f.IsExported() {
 			if len(index) > 0 {
-				f.Index = append(index, f.Index...)
+				f.Index = append(slices.Clip(index), f.Index...)
 			}
-			if f.Anonymous {
+			s, tagged := lookupTag(f.Tag, tags)
+			if tagged && s == "-" {
+				continue
+			}
+			if f.Anonymous && !(tagged && isValueType(f.Type)) {
 				if f.Type.Kind() == reflect.Struct {
-					fields = appendFields(fields, f.Type, f.Index)
+					fields = appendFields(fields, f.Type, f.Index, tags)
+				}
+			} else if tagged {
+				name, options := parseTag(s)
+				if _, isPath := options.value("jsonpath"); !isPath && !options.contains("extra") {
+					fields = append(fields, field{name, options, f})
 				}
-			} else if s, ok := f.Tag.Lookup("sql"); ok {
-				fields = append(fields, field{s, f})
 			}
 		}
 	}
@@ -1,9 +1,22 @@
 package sqlrange_test
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
 	"log"
+	"maps"
+	"net"
+	"reflect"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -97,6 +110,276 @@ func TestExec(t *testing.T) {
 	}
 }
 
+func TestExecSlice(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	people := []person{
+		{Age: 19, Name: "Luke"},
+		{Age: 42, Name: "Hitchhiker"},
+	}
+
+	n := 0
+	for res, err := range sqlrange.ExecSlice(context.Background(), db, `INSERT|people|name=?,age=?`, people,
+		sqlrange.ExecArgsFields[person]("name", "age"),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows, err := res.RowsAffected(); err != nil {
+			t.Fatal(err)
+		} else if rows != 1 {
+			t.Errorf("expect 1, got %d", rows)
+		}
+		n++
+	}
+	if n != len(people) {
+		t.Errorf("expect %d results, got %d", len(people), n)
+	}
+
+	ages, err := sqlrange.Reduce(sqlrange.Query[person](db, `SELECT|people|age,name|`), 0,
+		func(total int, p person) int { return total + p.Age },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ages != 1+2+3+19+42 {
+		t.Errorf("the rows were not inserted: sum of ages is %d", ages)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	birthday := time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)
+	p := person{Age: 42, Name: "Alice", BirthDate: birthday}
+
+	if args, expect := sqlrange.Args(p), []any{42, "Alice", birthday}; !slices.Equal(args, expect) {
+		t.Errorf("expect %v, got %v", expect, args)
+	}
+
+	args := sqlrange.Args(p, sqlrange.ExecArgs(func(args []any, p person) []any {
+		return append(args, strings.ToUpper(p.Name), p.Age+1)
+	}))
+	if expect := []any{"ALICE", 43}; !slices.Equal(args, expect) {
+		t.Errorf("expect %v, got %v", expect, args)
+	}
+
+	if args, expect := sqlrange.Args(p, sqlrange.ExecArgsFields[person]("name")), []any{"Alice"}; !slices.Equal(args, expect) {
+		t.Errorf("expect %v, got %v", expect, args)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expect a panic generating arguments from a non-struct type")
+		}
+	}()
+	sqlrange.Args(42)
+}
+
+func queryAnonymous(db *sql.DB) ([]struct {
+	Age  int    `sql:"age"`
+	Name string `sql:"name"`
+}, error) {
+	return sqlrange.Collect(sqlrange.Query[struct {
+		Age  int    `sql:"age"`
+		Name string `sql:"name"`
+	}](db, `SELECT|people|age,name|`))
+}
+
+func TestAnonymousStruct(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	rows, err := sqlrange.Collect(sqlrange.Query[struct {
+		Name string `sql:"name"`
+		Age  int    `sql:"age"`
+	}](db, `SELECT|people|age,name|`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Name != "Alice" || rows[0].Age != 1 {
+		t.Errorf("wrong rows: %+v", rows)
+	}
+
+	// Identical anonymous struct types declared in different places are the
+	// same type, so they share the same mapping.
+	others, err := queryAnonymous(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, err := sqlrange.Collect(sqlrange.Query[struct {
+		Age  int    `sql:"age"`
+		Name string `sql:"name"`
+	}](db, `SELECT|people|age,name|`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(others, same) || len(same) != 3 || same[2].Name != "Chris" {
+		t.Errorf("wrong rows: %+v and %+v", others, same)
+	}
+
+	// Anonymous struct types differing only by their tags are distinct types,
+	// which must not share the mapping of the other.
+	swapped, err := sqlrange.Collect(sqlrange.Query[struct {
+		Age  int    `sql:"-"`
+		Name string `sql:"name"`
+	}](db, `SELECT|people|name|`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(swapped) != 3 || swapped[1].Name != "Bob" || swapped[1].Age != 0 {
+		t.Errorf("wrong rows: %+v", swapped)
+	}
+}
+
+func TestExecArgsSubset(t *testing.T) {
+	type user struct {
+		ID    int64  `sql:"id"`
+		Name  string `sql:"name"`
+		Email string `sql:"email"`
+		Age   int64  `sql:"age"`
+	}
+
+	var queries []string
+	var execArgs [][]driver.Value
+	db := sql.OpenDB(&stubConnector{
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			values := make([]driver.Value, len(args))
+			for i, arg := range args {
+				values[i] = arg.Value
+			}
+			queries = append(queries, query)
+			execArgs = append(execArgs, values)
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+
+	present := func(u user) []string {
+		var columns []string
+		if u.Name != "" {
+			columns = append(columns, "name")
+		}
+		if u.Email != "" {
+			columns = append(columns, "email")
+		}
+		if u.Age != 0 {
+			columns = append(columns, "age")
+		}
+		return columns
+	}
+
+	users := []user{
+		{ID: 1, Name: "Alice", Age: 42},
+		{ID: 2, Email: "bob@example.com"},
+	}
+
+	for _, err := range sqlrange.ExecSlice(context.Background(), db, "", users,
+		sqlrange.ExecArgsSubset(present, "id"),
+		sqlrange.ExecQuery(func(_ string, u user) string {
+			return sqlrange.UpdateQuery(sqlrange.Postgres, "users", present(u), "id")
+		}),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectQueries := []string{
+		`UPDATE "users" SET "name" = $1, "age" = $2 WHERE "id" = $3`,
+		`UPDATE "users" SET "email" = $1 WHERE "id" = $2`,
+	}
+	if !slices.Equal(queries, expectQueries) {
+		t.Errorf("expect %q, got %q", expectQueries, queries)
+	}
+
+	expectArgs := [][]driver.Value{
+		{"Alice", int64(42), int64(1)},
+		{"bob@example.com", int64(2)},
+	}
+	if !slices.EqualFunc(execArgs, expectArgs, slices.Equal) {
+		t.Errorf("expect %v, got %v", expectArgs, execArgs)
+	}
+}
+
+func TestOptimisticLocking(t *testing.T) {
+	type account struct {
+		ID      int64  `sql:"id"`
+		Balance int64  `sql:"balance"`
+		Version uint32 `sql:"xmin"`
+	}
+
+	// The stub database holds a single account, the xmin system column is
+	// reported as text like drivers do for the xid type, and it changes each
+	// time the row is updated.
+	balance, xmin := int64(100), uint32(1234)
+	db := sql.OpenDB(&stubConnector{
+		query: func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"id", "balance", "xmin"},
+				[]driver.Value{int64(1), balance, []byte(strconv.Itoa(int(xmin)))},
+			), nil
+		},
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			if query != `UPDATE "accounts" SET "balance" = $1 WHERE "id" = $2 AND "xmin" = $3` {
+				return nil, fmt.Errorf("unexpected query: %s", query)
+			}
+			if args[1].Value != int64(1) || args[2].Value != int64(xmin) {
+				return driver.RowsAffected(0), nil
+			}
+			balance, xmin = args[0].Value.(int64), xmin+1
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+	ctx := context.Background()
+
+	var accounts []account
+	for a, err := range sqlrange.Query[account](db, `SELECT id, balance, xmin FROM accounts`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts = append(accounts, a)
+	}
+	if expect := []account{{ID: 1, Balance: 100, Version: 1234}}; !slices.Equal(accounts, expect) {
+		t.Fatalf("expect %v, got %v", expect, accounts)
+	}
+
+	columns := func(account) []string { return []string{"balance"} }
+	update := func(a account) (int64, error) {
+		var n int64
+		for r, err := range sqlrange.ExecSlice(ctx, db, "", []account{a},
+			sqlrange.ExecArgsSubset(columns, "id", "xmin"),
+			sqlrange.ExecQuery(func(_ string, a account) string {
+				return sqlrange.UpdateQuery(sqlrange.Postgres, "accounts", columns(a), "id", "xmin")
+			}),
+		) {
+			if err != nil {
+				return 0, err
+			}
+			n, _ = r.RowsAffected()
+		}
+		return n, nil
+	}
+
+	a := accounts[0]
+	a.Balance = 150
+	if n, err := update(a); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Errorf("expect the first update to succeed, got %d rows affected", n)
+	}
+
+	// The version read before the first update is now stale.
+	a.Balance = 200
+	if n, err := update(a); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Errorf("expect the stale update to be rejected, got %d rows affected", n)
+	}
+	if balance != 150 {
+		t.Errorf("expect a balance of 150, got %d", balance)
+	}
+}
+
 func TestQuery(t *testing.T) {
 	db := newTestDB(t, "people")
 	defer db.Close()
@@ -152,3 +435,2237 @@ func BenchmarkQuery100Rows(b *testing.B) {
 		}
 	}
 }
+
+func TestScanContextCanceled(t *testing.T) {
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		rows := newStubRows([]string{"age", "name"}, []driver.Value{int64(1), "Alice"})
+		rows.limit = -1
+		return rows, nil
+	})
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT age, name FROM people`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := 0
+	for _, err := range sqlrange.ScanContext[person](ctx, rows) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("expect %v, got %v", context.Canceled, err)
+			}
+			break
+		}
+		if n++; n == 3 {
+			cancel()
+		}
+		if n > 3 {
+			t.Fatal("the iteration continued after the context was canceled")
+		}
+	}
+
+	if n != 3 {
+		t.Errorf("expect 3 rows, got %d", n)
+	}
+	if rows.Next() {
+		t.Error("rows were not closed after the context was canceled")
+	}
+}
+
+func TestScanChan(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT|people|age,name|`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rowsCh, errCh := sqlrange.ScanChan[person](context.Background(), rows)
+
+	var people []person
+	for p := range rowsCh {
+		people = append(people, p)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []person{
+		{Age: 1, Name: "Alice"},
+		{Age: 2, Name: "Bob"},
+		{Age: 3, Name: "Chris"},
+	}
+	if !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+}
+
+func TestScanChanCanceled(t *testing.T) {
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		rows := newStubRows([]string{"age", "name"}, []driver.Value{int64(1), "Alice"})
+		rows.limit = -1
+		return rows, nil
+	})
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT age, name FROM people`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rowsCh, errCh := sqlrange.ScanChan[person](ctx, rows)
+
+	for range 3 {
+		<-rowsCh
+	}
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expect %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the goroutine did not terminate after the context was canceled")
+	}
+
+	for range rowsCh {
+	}
+	if _, ok := <-errCh; ok {
+		t.Error("the error channel was not closed")
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	var rows [][]any
+	for values, err := range sqlrange.QueryValues(context.Background(), db, `SELECT|people|name,age,photo|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, values)
+	}
+
+	expect := [][]any{
+		{[]byte("Alice"), int64(1), []byte("APHOTO")},
+		{[]byte("Bob"), int64(2), []byte("BPHOTO")},
+		{[]byte("Chris"), int64(3), []byte("CPHOTO")},
+	}
+	if !reflect.DeepEqual(rows, expect) {
+		t.Errorf("expect %v, got %v", expect, rows)
+	}
+}
+
+func TestScanValuesCopy(t *testing.T) {
+	values := []string{"a", "b", "c"}
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return &reusedBufferRows{values: values}, nil
+	})
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT meta FROM docs`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results [][]any
+	for v, err := range sqlrange.ScanValues(rows) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, v)
+	}
+
+	expect := [][]any{{[]byte("a")}, {[]byte("b")}, {[]byte("c")}}
+	if !reflect.DeepEqual(results, expect) {
+		t.Errorf("expect %q, got %q", expect, results)
+	}
+}
+
+func TestCompileScanner(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT|people|age,photo,name|`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var people []person
+	scan := sqlrange.CompileScanner[person](columns)
+	p := new(person)
+	for rows.Next() {
+		if err := scan(rows, p); err != nil {
+			t.Fatal(err)
+		}
+		people = append(people, *p)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []person{
+		{Age: 1, Name: "Alice"},
+		{Age: 2, Name: "Bob"},
+		{Age: 3, Name: "Chris"},
+	}
+
+	if !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+}
+
+func BenchmarkCompileScanner(b *testing.B) {
+	type point struct {
+		X int64 `sql:"x"`
+		Y int64 `sql:"y"`
+	}
+
+	columns := []string{"x", "y", "z"}
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		r := newStubRows(columns, []driver.Value{int64(1), int64(2), int64(3)})
+		r.limit = -1
+		return r, nil
+	})
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT x, y, z FROM points`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rows.Close()
+
+	scan := sqlrange.CompileScanner[point](columns)
+	p := new(point)
+	b.ReportAllocs()
+
+	for range b.N {
+		if !rows.Next() {
+			b.Fatal(rows.Err())
+		}
+		if err := scan(rows, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestScanPrepared(t *testing.T) {
+	type point struct {
+		X int64 `sql:"x"`
+		Y int64 `sql:"y"`
+	}
+
+	columns := []string{"x", "z", "y"}
+	db := newStubDB(func(_ string, args []driver.NamedValue) (driver.Rows, error) {
+		x := args[0].Value.(int64)
+		return newStubRows(columns,
+			[]driver.Value{x, int64(0), x + 1},
+			[]driver.Value{x + 2, int64(0), x + 3},
+		), nil
+	})
+	defer db.Close()
+
+	mapper := sqlrange.NewMapper[point](columns)
+	if !slices.Equal(mapper.Columns(), columns) {
+		t.Errorf("expect %q, got %q", columns, mapper.Columns())
+	}
+
+	var points []point
+	for _, x := range []int64{10, 20} {
+		rows, err := db.Query(`SELECT x, z, y FROM points WHERE x >= ?`, x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for p, err := range sqlrange.ScanPrepared(mapper, rows) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			points = append(points, p)
+		}
+	}
+
+	expect := []point{{10, 11}, {12, 13}, {20, 21}, {22, 23}}
+	if !slices.Equal(points, expect) {
+		t.Errorf("expect %v, got %v", expect, points)
+	}
+
+	rows, err := db.Query(`SELECT x, z, y FROM points WHERE x >= ?`, int64(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range sqlrange.ScanPrepared(sqlrange.NewMapper[point]([]string{"x", "y"}), rows) {
+		if err == nil {
+			t.Error("expect an error scanning rows with different columns than the mapper")
+		}
+	}
+}
+
+// wideRow is a struct type with many fields, some of which are promoted from
+// structs embedded more than one level deep.
+type wideRow struct {
+	ID int64 `sql:"id"`
+	WideAddress
+	F0 int64   `sql:"f0"`
+	F1 string  `sql:"f1"`
+	F2 float64 `sql:"f2"`
+	F3 int64   `sql:"f3"`
+	F4 string  `sql:"f4"`
+	F5 float64 `sql:"f5"`
+	F6 int64   `sql:"f6"`
+	F7 string  `sql:"f7"`
+	F8 float64 `sql:"f8"`
+	F9 bool    `sql:"f9"`
+}
+
+type WideAddress struct {
+	Street string `sql:"street"`
+	WideCity
+	Zip string `sql:"zip"`
+}
+
+type WideCity struct {
+	City string `sql:"city"`
+	WideGeo
+	Country string `sql:"country"`
+}
+
+type WideGeo struct {
+	Lat float64 `sql:"lat"`
+	Lng float64 `sql:"lng"`
+}
+
+func TestExecArgsEmbedded(t *testing.T) {
+	row := wideRow{
+		ID: 1,
+		WideAddress: WideAddress{
+			Street:   "1 Main St",
+			WideCity: WideCity{City: "Springfield", WideGeo: WideGeo{Lat: 1.5, Lng: 2.5}, Country: "US"},
+			Zip:      "12345",
+		},
+		F1: "one",
+		F9: true,
+	}
+
+	args := sqlrange.Args(row)
+	expect := []any{int64(1), "1 Main St", "Springfield", 1.5, 2.5, "US", "12345", int64(0), "one", 0.0, int64(0), "", 0.0, int64(0), "", 0.0, true}
+	if !slices.Equal(args, expect) {
+		t.Errorf("expect %v, got %v", expect, args)
+	}
+}
+
+func BenchmarkScanPrepared(b *testing.B) {
+	type point struct {
+		X int64 `sql:"x"`
+		Y int64 `sql:"y"`
+	}
+
+	columns := []string{"x", "y"}
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows(columns, []driver.Value{int64(1), int64(2)}), nil
+	})
+	defer db.Close()
+
+	query := func(b *testing.B, scan func(*sql.Rows) iter.Seq2[point, error]) {
+		b.ReportAllocs()
+		for range b.N {
+			rows, err := db.Query(`SELECT x, y FROM points`)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, err := range scan(rows) {
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	b.Run("Scan", func(b *testing.B) {
+		query(b, func(rows *sql.Rows) iter.Seq2[point, error] {
+			return sqlrange.Scan[point](rows)
+		})
+	})
+
+	b.Run("ScanPrepared", func(b *testing.B) {
+		mapper := sqlrange.NewMapper[point](columns)
+		query(b, func(rows *sql.Rows) iter.Seq2[point, error] {
+			return sqlrange.ScanPrepared(mapper, rows)
+		})
+	})
+}
+
+// reshapedRows is a driver.Rows which reports different columns after the
+// first call to Columns, simulating a driver changing the shape of the
+// result set after it was advertised.
+type reshapedRows struct {
+	*stubRows
+	calls int
+}
+
+func (r *reshapedRows) Columns() []string {
+	if r.calls++; r.calls == 1 {
+		return r.columns[:2]
+	}
+	return r.columns
+}
+
+func TestScanColumnsChanged(t *testing.T) {
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return &reshapedRows{
+			stubRows: newStubRows([]string{"age", "name", "bdate"},
+				[]driver.Value{int64(1), "Alice", nil},
+			),
+		}, nil
+	})
+	defer db.Close()
+
+	var err error
+	for _, err = range sqlrange.Query[person](db, `SELECT age, name FROM people`) {
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "from 2 to 3 columns") {
+		t.Errorf("error does not describe the change of columns: %v", err)
+	}
+}
+
+type execFunc func(context.Context, string, ...any) (sql.Result, error)
+
+func (f execFunc) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return f(ctx, query, args...)
+}
+
+func TestScanTypeMismatch(t *testing.T) {
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"name", "age"},
+			[]driver.Value{[]byte("Alice"), int64(1)},
+			[]driver.Value{"Bob", "two"},
+		), nil
+	})
+	defer db.Close()
+
+	var err error
+	for _, err = range sqlrange.Query[person](db, `SELECT name, age FROM people`) {
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.HasPrefix(err.Error(), `scanning column "age" into field Age of type int: `) {
+		t.Errorf("error does not describe the column and field: %v", err)
+	}
+	if !strings.Contains(err.Error(), `"two"`) {
+		t.Errorf("error does not mention the value: %v", err)
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	e := execFunc(func(ctx context.Context, query string, args ...any) (sql.Result, error) {
+		if args[0] == "Stuck" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return driver.RowsAffected(1), nil
+	})
+
+	var errs []error
+	for _, err := range sqlrange.Exec(e, `INSERT|people|name=?`,
+		func(yield func(person, error) bool) {
+			_ = yield(person{Name: "Luke"}, nil) &&
+				yield(person{Name: "Stuck"}, nil) &&
+				yield(person{Name: "Leia"}, nil)
+		},
+		sqlrange.ExecArgsFields[person]("name"),
+		sqlrange.ExecTimeout[person](10*time.Millisecond),
+	) {
+		errs = append(errs, err)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("expect 2 results, got %d", len(errs))
+	}
+	if errs[0] != nil {
+		t.Errorf("expect no error for the first row, got %v", errs[0])
+	}
+	if !errors.Is(errs[1], context.DeadlineExceeded) {
+		t.Errorf("expect context.DeadlineExceeded, got %v", errs[1])
+	}
+}
+
+func TestRawMessage(t *testing.T) {
+	type document struct {
+		ID   int64           `sql:"id"`
+		Meta json.RawMessage `sql:"meta"`
+	}
+
+	db := newTestDB(t, "")
+	defer db.Close()
+	exec(t, db, "CREATE|docs|id=int64,meta=string")
+
+	for _, err := range sqlrange.Exec(db, `INSERT|docs|id=?,meta=?`,
+		func(yield func(document, error) bool) {
+			_ = yield(document{ID: 1, Meta: json.RawMessage(`{"a":1}`)}, nil) &&
+				yield(document{ID: 2, Meta: json.RawMessage(`{"b":2}`)}, nil)
+		},
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var docs []document
+	for doc, err := range sqlrange.Query[document](db, `SELECT|docs|id,meta|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+
+	if len(docs) != 2 {
+		t.Fatalf("expect 2 documents, got %d", len(docs))
+	}
+	if string(docs[0].Meta) != `{"a":1}` || string(docs[1].Meta) != `{"b":2}` {
+		t.Errorf("wrong json values: %s, %s", docs[0].Meta, docs[1].Meta)
+	}
+}
+
+func TestRawMessageBufferReuse(t *testing.T) {
+	type document struct {
+		Meta json.RawMessage `sql:"meta"`
+	}
+
+	buffer := []byte(`{"a":1}`)
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return &reusedBufferRows{buffer: buffer, values: []string{`{"a":1}`, `{"b":2}`}}, nil
+	})
+	defer db.Close()
+
+	var docs []document
+	for doc, err := range sqlrange.Query[document](db, `SELECT meta FROM docs`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+
+	if len(docs) != 2 {
+		t.Fatalf("expect 2 documents, got %d", len(docs))
+	}
+	if string(docs[0].Meta) != `{"a":1}` || string(docs[1].Meta) != `{"b":2}` {
+		t.Errorf("retained json values were overwritten: %s, %s", docs[0].Meta, docs[1].Meta)
+	}
+}
+
+// reusedBufferRows is a driver.Rows which returns all its values in the same
+// byte buffer, like drivers reusing their read buffers across rows do.
+type reusedBufferRows struct {
+	buffer []byte
+	values []string
+	index  int
+}
+
+func (r *reusedBufferRows) Columns() []string { return []string{"meta"} }
+
+func (r *reusedBufferRows) Close() error { return nil }
+
+func (r *reusedBufferRows) Next(dest []driver.Value) error {
+	if r.index == len(r.values) {
+		return io.EOF
+	}
+	r.buffer = append(r.buffer[:0], r.values[r.index]...)
+	r.index++
+	dest[0] = r.buffer
+	return nil
+}
+
+type taggedResult struct {
+	driver.Result
+	tag string
+}
+
+func (r taggedResult) CommandTag() string { return r.tag }
+
+func TestExecResults(t *testing.T) {
+	e := execFunc(func(ctx context.Context, query string, args ...any) (sql.Result, error) {
+		if args[0] == "Luke" {
+			return taggedResult{driver.RowsAffected(1), "INSERT 0 1"}, nil
+		}
+		return driver.RowsAffected(1), nil
+	})
+
+	var results []sqlrange.Result
+	for res, err := range sqlrange.ExecResults(context.Background(), e, `INSERT|people|name=?`,
+		func(yield func(person, error) bool) {
+			_ = yield(person{Name: "Luke"}, nil) &&
+				yield(person{Name: "Leia"}, nil)
+		},
+		sqlrange.ExecArgsFields[person]("name"),
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, res)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expect 2 results, got %d", len(results))
+	}
+	if tag := results[0].CommandTag; tag != "INSERT 0 1" {
+		t.Errorf("expect command tag %q, got %q", "INSERT 0 1", tag)
+	}
+	if tag := results[1].CommandTag; tag != "" {
+		t.Errorf("expect no command tag, got %q", tag)
+	}
+	if n, err := results[1].RowsAffected(); err != nil || n != 1 {
+		t.Errorf("expect 1 row affected, got %d (%v)", n, err)
+	}
+}
+
+func TestQueryScalar(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	db := newStubDB(func(query string, _ []driver.NamedValue) (driver.Rows, error) {
+		switch query {
+		case `SELECT MAX(age) FROM people`:
+			return newStubRows([]string{"max"}, []driver.Value{int64(3)}), nil
+		case `SELECT NOW()`:
+			return newStubRows([]string{"now"}, []driver.Value{now}), nil
+		case `SELECT age FROM people WHERE false`:
+			return newStubRows([]string{"age"}), nil
+		case `SELECT age FROM people`:
+			return newStubRows([]string{"age"}, []driver.Value{int64(1)}, []driver.Value{int64(2)}), nil
+		default:
+			return newStubRows([]string{"age", "name"}, []driver.Value{int64(1), "Alice"}), nil
+		}
+	})
+	defer db.Close()
+	metrics := new(counters)
+	ctx := sqlrange.WithMetrics(context.Background(), metrics)
+
+	if age, err := sqlrange.QueryScalar[int](ctx, db, `SELECT MAX(age) FROM people`); err != nil {
+		t.Error(err)
+	} else if age != 3 {
+		t.Errorf("expect 3, got %d", age)
+	}
+
+	if t0, err := sqlrange.QueryScalar[time.Time](ctx, db, `SELECT NOW()`); err != nil {
+		t.Error(err)
+	} else if !t0.Equal(now) {
+		t.Errorf("expect %v, got %v", now, t0)
+	}
+
+	if _, err := sqlrange.QueryScalar[int](ctx, db, `SELECT age FROM people WHERE false`); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expect sql.ErrNoRows, got %v", err)
+	}
+
+	if _, err := sqlrange.QueryScalar[int](ctx, db, `SELECT age FROM people`); err == nil {
+		t.Error("expect an error for a query returning more than one row")
+	}
+
+	if _, err := sqlrange.QueryScalar[int](ctx, db, `SELECT age, name FROM people`); err == nil {
+		t.Error("expect an error for a query returning more than one column")
+	}
+
+	if q, r, e := metrics.queries.Load(), metrics.rows.Load(), metrics.errors.Load(); q != 5 || r != 3 || e != 3 {
+		t.Errorf("expect 5 queries, 3 rows, and 3 errors, got %d, %d, and %d", q, r, e)
+	}
+}
+
+func TestQueryMap(t *testing.T) {
+	db := newStubDB(func(query string, _ []driver.NamedValue) (driver.Rows, error) {
+		switch query {
+		case `SELECT status, COUNT(*) FROM orders GROUP BY status`:
+			return newStubRows([]string{"status", "count"},
+				[]driver.Value{"pending", int64(2)},
+				[]driver.Value{"shipped", int64(5)},
+			), nil
+		case `SELECT status, MAX(item) FROM orders GROUP BY status`:
+			return newStubRows([]string{"status", "max"},
+				[]driver.Value{"pending", "pear"},
+				[]driver.Value{"shipped", "apple"},
+			), nil
+		default:
+			return newStubRows([]string{"status"}, []driver.Value{"pending"}), nil
+		}
+	})
+	defer db.Close()
+	metrics := new(counters)
+	ctx := sqlrange.WithMetrics(context.Background(), metrics)
+
+	counts, err := sqlrange.QueryCountMap[string](ctx, db, `SELECT status, COUNT(*) FROM orders GROUP BY status`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[string]int64{"pending": 2, "shipped": 5}; !maps.Equal(counts, expect) {
+		t.Errorf("expect %v, got %v", expect, counts)
+	}
+
+	items, err := sqlrange.QueryMap[string, string](ctx, db, `SELECT status, MAX(item) FROM orders GROUP BY status`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[string]string{"pending": "pear", "shipped": "apple"}; !maps.Equal(items, expect) {
+		t.Errorf("expect %v, got %v", expect, items)
+	}
+
+	if _, err := sqlrange.QueryCountMap[string](ctx, db, `SELECT status FROM orders`); err == nil {
+		t.Error("expect an error for a query returning one column")
+	}
+
+	if q, r, e := metrics.queries.Load(), metrics.rows.Load(), metrics.errors.Load(); q != 3 || r != 4 || e != 1 {
+		t.Errorf("expect 3 queries, 4 rows, and 1 error, got %d, %d, and %d", q, r, e)
+	}
+}
+
+func TestResetFieldsCache(t *testing.T) {
+	columns := func() []string {
+		var names []string
+		for name := range sqlrange.Fields(reflect.TypeOf(person{})) {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	expect := []string{"age", "name", "bdate"}
+	if names := columns(); !slices.Equal(names, expect) {
+		t.Fatalf("expect %q, got %q", expect, names)
+	}
+	sqlrange.ResetFieldsCache()
+	if names := columns(); !slices.Equal(names, expect) {
+		t.Errorf("expect %q after resetting the cache, got %q", expect, names)
+	}
+
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				sqlrange.ResetFieldsCache()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				for _, err := range sqlrange.Query[person](db, `SELECT|people|age,name|`) {
+					if err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFieldsSorted(t *testing.T) {
+	type row1 struct {
+		Name string `sql:"name"`
+		Age  int    `sql:"age"`
+		ID   int64  `sql:"id"`
+	}
+	type row2 struct {
+		ID   int64  `sql:"id"`
+		Age  int    `sql:"age"`
+		Name string `sql:"name"`
+	}
+
+	expect := []string{"age", "id", "name"}
+
+	for _, typ := range []reflect.Type{reflect.TypeFor[row1](), reflect.TypeFor[row2]()} {
+		var columns []string
+		for columnName := range sqlrange.FieldsSorted(typ) {
+			columns = append(columns, columnName)
+		}
+		if !slices.Equal(columns, expect) {
+			t.Errorf("%s: expect %v, got %v", typ, expect, columns)
+		}
+	}
+}
+
+// Point is a type converting itself to and from "x,y" strings, which is
+// embedded in struct types to test that it is mapped to a single column.
+type Point struct {
+	X int `sql:"x"`
+	Y int `sql:"y"`
+}
+
+func (p *Point) Scan(src any) error {
+	s, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("unsupported point value: %T", src)
+	}
+	_, err := fmt.Sscanf(s, "%d,%d", &p.X, &p.Y)
+	return err
+}
+
+func (p Point) Value() (driver.Value, error) {
+	return fmt.Sprintf("%d,%d", p.X, p.Y), nil
+}
+
+func TestEmbeddedScanner(t *testing.T) {
+	type place struct {
+		Name  string `sql:"name"`
+		Point `sql:"location"`
+	}
+
+	var columns []string
+	for columnName := range sqlrange.Fields(reflect.TypeFor[place]()) {
+		columns = append(columns, columnName)
+	}
+	if expect := []string{"name", "location"}; !slices.Equal(columns, expect) {
+		t.Errorf("expect %v, got %v", expect, columns)
+	}
+
+	var execArgs []driver.Value
+	db := sql.OpenDB(&stubConnector{
+		query: func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"name", "location"}, []driver.Value{"home", "1,2"}), nil
+		},
+		exec: func(_ string, args []driver.NamedValue) (driver.Result, error) {
+			for _, arg := range args {
+				execArgs = append(execArgs, arg.Value)
+			}
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+
+	var places []place
+	for p, err := range sqlrange.Query[place](db, `SELECT name, location FROM places`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		places = append(places, p)
+	}
+	if expect := []place{{Name: "home", Point: Point{X: 1, Y: 2}}}; !slices.Equal(places, expect) {
+		t.Errorf("expect %v, got %v", expect, places)
+	}
+
+	for _, err := range sqlrange.Exec(db, `INSERT INTO places (name, location) VALUES (?, ?)`,
+		func(yield func(place, error) bool) {
+			yield(place{Name: "work", Point: Point{X: 3, Y: 4}}, nil)
+		},
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expect := []driver.Value{"work", "3,4"}; !slices.Equal(execArgs, expect) {
+		t.Errorf("expect %v, got %v", expect, execArgs)
+	}
+}
+
+func TestNumColumns(t *testing.T) {
+	type Audit struct {
+		CreatedAt time.Time `sql:"created_at"`
+		UpdatedAt time.Time `sql:"updated_at"`
+	}
+	type Internal struct {
+		Secret string `sql:"secret"`
+	}
+	type row struct {
+		ID       int64  `sql:"id"`
+		Name     string `sql:"name"`
+		Password string `sql:"-"`
+		Notes    string
+		Audit
+		Internal `sql:"-"`
+	}
+
+	if n := sqlrange.NumColumns[row](); n != 4 {
+		t.Errorf("expect 4 columns, got %d", n)
+	}
+	if n := sqlrange.NumColumns[person](); n != 3 {
+		t.Errorf("expect 3 columns, got %d", n)
+	}
+}
+
+func TestFieldColumns(t *testing.T) {
+	expect := map[string]string{"Age": "age", "Name": "name", "BirthDate": "bdate"}
+	if columns := sqlrange.FieldColumns[person](); !maps.Equal(columns, expect) {
+		t.Errorf("expect %v, got %v", expect, columns)
+	}
+
+	type Person = person
+	type employee struct {
+		Person
+		Manager
+		ID int64 `sql:"id"`
+	}
+
+	expect = map[string]string{
+		"Age":         "age",
+		"Name":        "name",
+		"BirthDate":   "bdate",
+		"ManagerName": "manager_name",
+		"ManagerAge":  "manager_age",
+		"ID":          "id",
+	}
+	if columns := sqlrange.FieldColumns[employee](); !maps.Equal(columns, expect) {
+		t.Errorf("expect %v, got %v", expect, columns)
+	}
+}
+
+func TestExecNonStructRow(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	n := 0
+	for _, err := range sqlrange.Exec(db, `INSERT|people|name=?,age=?`,
+		func(yield func([]person, error) bool) {
+			yield([]person{{Age: 19, Name: "Luke"}}, nil)
+		},
+	) {
+		n++
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if !strings.Contains(err.Error(), "[]sqlrange_test.person") || !strings.Contains(err.Error(), "ExecArgs") {
+			t.Errorf("error is not helpful: %v", err)
+		}
+	}
+	if n != 1 {
+		t.Errorf("expect 1 result, got %d", n)
+	}
+}
+
+func TestCompileScannerReset(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	p := new(person)
+
+	scanFirst := func(query string) {
+		t.Helper()
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		columns, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+		scan := sqlrange.CompileScanner[person](columns)
+		if !rows.Next() {
+			t.Fatal(rows.Err())
+		}
+		if err := scan(rows, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p.BirthDate = chrisBirthday
+	scanFirst(`SELECT|people|age,name|`)
+	if !p.BirthDate.IsZero() {
+		t.Errorf("unmapped field retained its value: %v", p.BirthDate)
+	}
+
+	scanFirst(`SELECT|people|name|`)
+	if p.Age != 0 {
+		t.Errorf("unmapped field retained the value of the previous row: %d", p.Age)
+	}
+	if p.Name != "Alice" {
+		t.Errorf("expect Alice, got %q", p.Name)
+	}
+}
+
+// savepointTx is an Executable simulating a transaction with support for
+// savepoints, queries insert their first argument in the list of rows, and
+// fail when the argument is "fail".
+type savepointTx struct {
+	rows       []string
+	savepoints []int
+	statements []string
+	// failRelease makes RELEASE SAVEPOINT statements fail, leaving the
+	// savepoint open.
+	failRelease bool
+}
+
+func (tx *savepointTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	tx.statements = append(tx.statements, query)
+	switch query {
+	case "SAVEPOINT sqlrange_savepoint":
+		tx.savepoints = append(tx.savepoints, len(tx.rows))
+	case "RELEASE SAVEPOINT sqlrange_savepoint":
+		if tx.failRelease {
+			return nil, errors.New("release failed")
+		}
+		tx.savepoints = tx.savepoints[:len(tx.savepoints)-1]
+	case "ROLLBACK TO SAVEPOINT sqlrange_savepoint":
+		tx.rows = tx.rows[:tx.savepoints[len(tx.savepoints)-1]]
+	default:
+		if args[0] == "fail" {
+			return nil, errors.New("insert failed")
+		}
+		tx.rows = append(tx.rows, args[0].(string))
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func insertNames(tx *savepointTx, names []string, opts ...sqlrange.ExecOption[person]) (errs []error) {
+	for _, err := range sqlrange.Exec(tx, `INSERT|people|name=?`,
+		func(yield func(person, error) bool) {
+			for _, name := range names {
+				if !yield(person{Name: name}, nil) {
+					return
+				}
+			}
+		},
+		append(opts, sqlrange.ExecArgsFields[person]("name"))...,
+	) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func TestExecAll(t *testing.T) {
+	tx := new(savepointTx)
+	people := []person{{Name: "a"}, {Name: "fail"}, {Name: "b"}, {Name: "fail"}, {Name: "c"}}
+
+	err := sqlrange.ExecAll(context.Background(), tx, `INSERT|people|name=?`,
+		sqlrange.Seq2FromSeq(slices.Values(people)),
+		sqlrange.ExecArgsFields[person]("name"),
+	)
+
+	if expect := []string{"a", "b", "c"}; !slices.Equal(tx.rows, expect) {
+		t.Errorf("expect rows %v, got %v", expect, tx.rows)
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("expect a joined error, got %v", err)
+	}
+	var indexes []int
+	for _, err := range joined.Unwrap() {
+		var execErr *sqlrange.ExecError
+		if !errors.As(err, &execErr) {
+			t.Fatalf("expect an ExecError, got %v", err)
+		}
+		indexes = append(indexes, execErr.Index)
+	}
+	if expect := []int{1, 3}; !slices.Equal(indexes, expect) {
+		t.Errorf("expect errors for rows %v, got %v", expect, indexes)
+	}
+	for _, row := range []string{"row 1", "row 3"} {
+		if !strings.Contains(err.Error(), row) {
+			t.Errorf("expect the error to mention %s, got %v", row, err)
+		}
+	}
+
+	if err := sqlrange.ExecAll(context.Background(), tx, `INSERT|people|name=?`,
+		sqlrange.Seq2FromSeq(slices.Values(people[:1])),
+		sqlrange.ExecArgsFields[person]("name"),
+	); err != nil {
+		t.Errorf("expect no error, got %v", err)
+	}
+}
+
+func TestExecResult(t *testing.T) {
+	db := sql.OpenDB(&stubConnector{
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			if args[0].Value == "fail" {
+				return nil, errors.New("insert failed")
+			}
+			return driver.RowsAffected(2), nil
+		},
+	})
+	defer db.Close()
+
+	people := []person{{Name: "a"}, {Name: "b"}, {Name: "fail"}, {Name: "c"}}
+
+	n, err := sqlrange.ExecResult(context.Background(), db, `INSERT INTO people (name) VALUES (?)`,
+		sqlrange.Seq2FromSeq(slices.Values(people)),
+		sqlrange.ExecArgsFields[person]("name"),
+	)
+	var execErr *sqlrange.ExecError
+	if !errors.As(err, &execErr) || execErr.Index != 2 {
+		t.Errorf("expect an error for row 2, got %v", err)
+	}
+	if n != 4 {
+		t.Errorf("expect 4 rows affected before the error, got %d", n)
+	}
+
+	n, err = sqlrange.ExecResult(context.Background(), db, `INSERT INTO people (name) VALUES (?)`,
+		sqlrange.Seq2FromSeq(slices.Values(people[:2])),
+		sqlrange.ExecArgsFields[person]("name"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("expect 4 rows affected, got %d", n)
+	}
+}
+
+func TestExecMulti(t *testing.T) {
+	var execs []string
+	db := sql.OpenDB(&stubConnector{
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			values := make([]string, len(args))
+			for i, arg := range args {
+				values[i] = fmt.Sprint(arg.Value)
+			}
+			if slices.Contains(values, "fail") {
+				return nil, errors.New("insert failed")
+			}
+			execs = append(execs, query+" "+strings.Join(values, ","))
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+
+	queries := []string{
+		`INSERT INTO people (name, age) VALUES (?, ?)`,
+		`INSERT INTO audit (name) VALUES (?)`,
+	}
+	args := []func([]any, person) []any{
+		func(args []any, p person) []any { return append(args, p.Name, p.Age) },
+		func(args []any, p person) []any { return append(args, "created "+p.Name) },
+	}
+	people := []person{{Name: "Alice", Age: 1}, {Name: "Bob", Age: 2}}
+
+	results := 0
+	for _, err := range sqlrange.ExecMulti(context.Background(), db, queries, sqlrange.Seq2FromSeq(slices.Values(people)), args) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		results++
+	}
+	if results != 4 {
+		t.Errorf("expect 4 results, got %d", results)
+	}
+
+	expect := []string{
+		`INSERT INTO people (name, age) VALUES (?, ?) Alice,1`,
+		`INSERT INTO audit (name) VALUES (?) created Alice`,
+		`INSERT INTO people (name, age) VALUES (?, ?) Bob,2`,
+		`INSERT INTO audit (name) VALUES (?) created Bob`,
+	}
+	if !slices.Equal(execs, expect) {
+		t.Errorf("expect %q, got %q", expect, execs)
+	}
+
+	execs = nil
+	args[1] = func(args []any, p person) []any {
+		if p.Name == "Bob" {
+			return append(args, "fail")
+		}
+		return append(args, p.Name)
+	}
+	_, err := sqlrange.Collect(sqlrange.ExecMulti(context.Background(), db, queries, sqlrange.Seq2FromSeq(slices.Values(people)), args))
+	var execErr *sqlrange.ExecError
+	if !errors.As(err, &execErr) || execErr.Index != 1 {
+		t.Errorf("expect an error for row 1, got %v", err)
+	}
+	if len(execs) != 3 {
+		t.Errorf("expect 3 statements executed before the error, got %d", len(execs))
+	}
+
+	if _, err := sqlrange.Collect(sqlrange.ExecMulti(context.Background(), db, queries, sqlrange.Seq2FromSeq(slices.Values(people)), args[:1])); err == nil {
+		t.Error("expect an error when the number of queries and argument functions differ")
+	}
+}
+
+func TestExecTx(t *testing.T) {
+	var events []string
+	db := sql.OpenDB(&stubConnector{
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			for _, arg := range args {
+				if arg.Value == "fail" {
+					return nil, errors.New("insert failed")
+				}
+			}
+			events = append(events, query)
+			return driver.RowsAffected(1), nil
+		},
+		tx: func(end string) error {
+			events = append(events, end)
+			return nil
+		},
+	})
+	defer db.Close()
+
+	before := sqlrange.ExecBefore[person](func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `SET CONSTRAINTS ALL DEFERRED`)
+		return err
+	})
+	after := sqlrange.ExecAfter[person](func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO audit DEFAULT VALUES`)
+		return err
+	})
+	const insert = `INSERT INTO people (name) VALUES (?)`
+
+	people := []person{{Name: "a"}, {Name: "b"}}
+	err := sqlrange.ExecTx(context.Background(), db, nil, insert, sqlrange.Seq2FromSeq(slices.Values(people)),
+		before, after, sqlrange.ExecArgsFields[person]("name"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{`SET CONSTRAINTS ALL DEFERRED`, insert, insert, `INSERT INTO audit DEFAULT VALUES`, "commit"}
+	if !slices.Equal(events, expect) {
+		t.Errorf("expect %q, got %q", expect, events)
+	}
+
+	events = nil
+	people = []person{{Name: "a"}, {Name: "fail"}, {Name: "b"}}
+	err = sqlrange.ExecTx(context.Background(), db, nil, insert, sqlrange.Seq2FromSeq(slices.Values(people)),
+		before, after, sqlrange.ExecArgsFields[person]("name"),
+	)
+	var execErr *sqlrange.ExecError
+	if !errors.As(err, &execErr) || execErr.Index != 1 {
+		t.Errorf("expect an error for row 1, got %v", err)
+	}
+
+	expect = []string{`SET CONSTRAINTS ALL DEFERRED`, insert, "rollback"}
+	if !slices.Equal(events, expect) {
+		t.Errorf("expect %q, got %q", expect, events)
+	}
+}
+
+func TestExecSavepoint(t *testing.T) {
+	tx := new(savepointTx)
+	errs := insertNames(tx, []string{"a", "b", "c", "fail", "d"},
+		sqlrange.ExecSavepoint[person](2),
+	)
+
+	if len(errs) != 1 {
+		t.Fatalf("expect 1 error, got %v", errs)
+	}
+	if expect := []string{"a", "b"}; !slices.Equal(tx.rows, expect) {
+		t.Errorf("expect rows %v, got %v", expect, tx.rows)
+	}
+	if len(tx.savepoints) != 0 {
+		t.Errorf("savepoints were not released: %v", tx.savepoints)
+	}
+}
+
+func TestExecSavepointBreak(t *testing.T) {
+	tx := new(savepointTx)
+	metrics := new(counters)
+	ctx := sqlrange.WithMetrics(context.Background(), metrics)
+	people := []person{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+
+	exec := func() {
+		for _, err := range sqlrange.ExecContext(ctx, tx, `INSERT|people|name=?`,
+			sqlrange.Seq2FromSeq(slices.Values(people)),
+			sqlrange.ExecSavepoint[person](2),
+			sqlrange.ExecArgsFields[person]("name"),
+		) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+
+	exec()
+	if expect := []string{"a"}; !slices.Equal(tx.rows, expect) {
+		t.Errorf("expect rows %v, got %v", expect, tx.rows)
+	}
+	if len(tx.savepoints) != 0 {
+		t.Errorf("savepoints were not released: %v", tx.savepoints)
+	}
+	if n := metrics.errors.Load(); n != 0 {
+		t.Errorf("expect no errors, got %d", n)
+	}
+
+	tx.failRelease = true
+	exec()
+	if len(tx.savepoints) != 1 {
+		t.Errorf("expect the savepoint to remain open, got %v", tx.savepoints)
+	}
+	if n := metrics.errors.Load(); n != 1 {
+		t.Errorf("expect the failure to release the savepoint to be counted, got %d errors", n)
+	}
+}
+
+func TestExecSavepointContinueOnError(t *testing.T) {
+	tx := new(savepointTx)
+	errs := insertNames(tx, []string{"a", "b", "c", "fail", "d", "fail", "e"},
+		sqlrange.ExecSavepoint[person](2),
+		sqlrange.ExecContinueOnError[person](),
+	)
+
+	if len(errs) != 2 {
+		t.Fatalf("expect 2 errors, got %v", errs)
+	}
+	if expect := []string{"a", "b", "e"}; !slices.Equal(tx.rows, expect) {
+		t.Errorf("expect rows %v, got %v", expect, tx.rows)
+	}
+	if len(tx.savepoints) != 0 {
+		t.Errorf("savepoints were not released: %v", tx.savepoints)
+	}
+}
+
+func TestExecContinueOnError(t *testing.T) {
+	tx := new(savepointTx)
+	errs := insertNames(tx, []string{"a", "fail", "b"},
+		sqlrange.ExecContinueOnError[person](),
+	)
+
+	if len(errs) != 1 {
+		t.Fatalf("expect 1 error, got %v", errs)
+	}
+	if expect := []string{"a", "b"}; !slices.Equal(tx.rows, expect) {
+		t.Errorf("expect rows %v, got %v", expect, tx.rows)
+	}
+	for _, stmt := range tx.statements {
+		if strings.Contains(stmt, "SAVEPOINT") {
+			t.Errorf("unexpected savepoint statement: %s", stmt)
+		}
+	}
+}
+
+func TestExecRequireAffected(t *testing.T) {
+	db := sql.OpenDB(&stubConnector{
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			// Only the person named Alice exists in the table.
+			if args[1].Value == "Alice" {
+				return driver.RowsAffected(1), nil
+			}
+			return driver.RowsAffected(0), nil
+		},
+	})
+	defer db.Close()
+
+	people := []person{{Age: 42, Name: "Alice"}, {Age: 21, Name: "Bob"}}
+
+	var errs []error
+	for _, err := range sqlrange.ExecSlice(context.Background(), db, `UPDATE people SET age = ? WHERE name = ?`, people,
+		sqlrange.ExecArgsFields[person]("age", "name"),
+		sqlrange.ExecRequireAffected[person](1),
+		sqlrange.ExecContinueOnError[person](),
+	) {
+		errs = append(errs, err)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("expect 2 results, got %d", len(errs))
+	}
+	if errs[0] != nil {
+		t.Errorf("expect no error updating an existing row, got %v", errs[0])
+	}
+	if !errors.Is(errs[1], sqlrange.ErrTooFewRowsAffected) {
+		t.Errorf("expect %v, got %v", sqlrange.ErrTooFewRowsAffected, errs[1])
+	}
+	var execErr *sqlrange.ExecError
+	if !errors.As(errs[1], &execErr) || execErr.Index != 1 {
+		t.Errorf("expect an error for the row at index 1, got %v", errs[1])
+	}
+}
+
+func TestExecError(t *testing.T) {
+	tx := new(savepointTx)
+	errs := insertNames(tx, []string{"a", "b", "fail", "c"})
+
+	if len(errs) != 1 {
+		t.Fatalf("expect 1 error, got %v", errs)
+	}
+
+	var execErr *sqlrange.ExecError
+	if !errors.As(errs[0], &execErr) {
+		t.Fatalf("expect *sqlrange.ExecError, got %T", errs[0])
+	}
+	if execErr.Index != 2 {
+		t.Errorf("expect index 2, got %d", execErr.Index)
+	}
+	if execErr.Err == nil || execErr.Err.Error() != "insert failed" {
+		t.Errorf("wrong underlying error: %v", execErr.Err)
+	}
+	if execErr.Query != `INSERT|people|name=?` {
+		t.Errorf("wrong query: %q", execErr.Query)
+	}
+	if expect := []any{"fail"}; !slices.Equal(execErr.Args, expect) {
+		t.Errorf("expect args %v, got %v", expect, execErr.Args)
+	}
+}
+
+func TestExecErrorRewrittenQuery(t *testing.T) {
+	tx := new(savepointTx)
+	ctx := sqlrange.WithQueryRewriter(context.Background(), func(_ context.Context, query string) (string, error) {
+		return query + " /* app */", nil
+	})
+
+	people := []person{{Name: "a", Age: 1}, {Name: "fail", Age: 2}}
+	_, err := sqlrange.Collect(sqlrange.ExecSlice(ctx, tx, `INSERT|people|name=?`, people,
+		sqlrange.ExecQuery(func(query string, p person) string {
+			return query + ",age=" + strconv.Itoa(p.Age)
+		}),
+		sqlrange.ExecArgsFields[person]("name"),
+	))
+
+	var execErr *sqlrange.ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expect *sqlrange.ExecError, got %v", err)
+	}
+	if expect := `INSERT|people|name=?,age=2 /* app */`; execErr.Query != expect {
+		t.Errorf("expect query %q, got %q", expect, execErr.Query)
+	}
+	if expect := []any{"fail"}; !slices.Equal(execErr.Args, expect) {
+		t.Errorf("expect args %v, got %v", expect, execErr.Args)
+	}
+}
+
+func TestQueryEach(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	var people []person
+	for p, err := range sqlrange.QueryEach[string, person](context.Background(), db, `SELECT|people|age,name|name=?`,
+		func(yield func(string, error) bool) {
+			_ = yield("Chris", nil) &&
+				yield("Alice", nil) &&
+				yield("Nobody", nil) &&
+				yield("Bob", nil)
+		},
+		func(name string) []any { return []any{name} },
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		people = append(people, p)
+	}
+
+	expect := []person{
+		{Age: 3, Name: "Chris"},
+		{Age: 1, Name: "Alice"},
+		{Age: 2, Name: "Bob"},
+	}
+
+	if !slices.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+}
+
+func TestQueryBatch(t *testing.T) {
+	db := newStubDB(func(_ string, args []driver.NamedValue) (driver.Rows, error) {
+		owner := args[0].Value.(string)
+		return newStubRows([]string{"order", "item"},
+			[]driver.Value{int64(1), owner + "-apple"},
+			[]driver.Value{int64(2), owner + "-pear"},
+		), nil
+	})
+	defer db.Close()
+
+	var orders []order
+	for o, err := range sqlrange.QueryBatch[string, order](context.Background(), db,
+		`SELECT order, item FROM orders WHERE owner = ?`,
+		[]string{"alice", "bob"},
+		func(owner string) []any { return []any{owner} },
+	) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders = append(orders, o)
+	}
+
+	expect := []order{
+		{Order: 1, Item: "alice-apple"},
+		{Order: 2, Item: "alice-pear"},
+		{Order: 1, Item: "bob-apple"},
+		{Order: 2, Item: "bob-pear"},
+	}
+
+	if !slices.Equal(orders, expect) {
+		t.Errorf("expect %v, got %v", expect, orders)
+	}
+}
+
+func TestExecNilSequence(t *testing.T) {
+	tx := new(savepointTx)
+
+	for res, err := range sqlrange.Exec[person](tx, `INSERT|people|name=?`, nil) {
+		t.Errorf("unexpected result: %v, %v", res, err)
+	}
+	if len(tx.statements) != 0 {
+		t.Errorf("unexpected statements: %v", tx.statements)
+	}
+}
+
+func TestQueryKeyedBy(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	people, err := sqlrange.QueryKeyedBy(context.Background(), db, `SELECT|people|age,name|`,
+		func(p person) string { return p.Name },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]person{
+		"Alice": {Age: 1, Name: "Alice"},
+		"Bob":   {Age: 2, Name: "Bob"},
+		"Chris": {Age: 3, Name: "Chris"},
+	}
+	if !maps.Equal(people, expect) {
+		t.Errorf("expect %v, got %v", expect, people)
+	}
+
+	byParity := func(p person) bool { return p.Age%2 == 0 }
+
+	_, err = sqlrange.QueryKeyedBy(context.Background(), db, `SELECT|people|age,name|`, byParity)
+	if !errors.Is(err, sqlrange.ErrDuplicateKey) {
+		t.Errorf("expect ErrDuplicateKey, got %v", err)
+	}
+
+	parity, err := sqlrange.QueryKeyedByLastWins(context.Background(), db, `SELECT|people|age,name|`, byParity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[bool]person{false: {Age: 3, Name: "Chris"}, true: {Age: 2, Name: "Bob"}}; !maps.Equal(parity, expect) {
+		t.Errorf("expect %v, got %v", expect, parity)
+	}
+}
+
+func TestCopyRows(t *testing.T) {
+	type item struct {
+		ID   int64  `sql:"id"`
+		Name string `sql:"name"`
+	}
+
+	orders := [][]driver.Value{
+		{int64(1), "apple"},
+		{int64(2), "banana"},
+		{int64(3), "cherry"},
+	}
+	var archive [][]driver.Value
+	var queries []string
+
+	db := sql.OpenDB(&stubConnector{
+		query: func(query string, args []driver.NamedValue) (driver.Rows, error) {
+			if query != `SELECT id, name FROM orders WHERE id <= $1` || args[0].Value != int64(3) {
+				return nil, fmt.Errorf("unexpected query: %s", query)
+			}
+			return newStubRows([]string{"id", "name"}, orders...), nil
+		},
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			queries = append(queries, query)
+			values := make([]driver.Value, len(args))
+			for i, arg := range args {
+				values[i] = arg.Value
+			}
+			archive = append(archive, values)
+			return driver.RowsAffected(len(args) / 2), nil
+		},
+	})
+	defer db.Close()
+
+	n, err := sqlrange.CopyRows[item](context.Background(), db, db, sqlrange.Postgres,
+		`SELECT id, name FROM orders WHERE id <= $1`, "archive", []string{"name", "id"}, int64(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expect 3 rows copied, got %d", n)
+	}
+
+	const insert = `INSERT INTO "archive" ("name", "id") VALUES ($1, $2), ($3, $4), ($5, $6)`
+	if expect := []string{insert}; !slices.Equal(queries, expect) {
+		t.Errorf("expect %q, got %q", expect, queries)
+	}
+
+	expect := [][]driver.Value{
+		{"apple", int64(1), "banana", int64(2), "cherry", int64(3)},
+	}
+	if !slices.EqualFunc(archive, expect, slices.Equal) {
+		t.Errorf("expect %v, got %v", expect, archive)
+	}
+
+	// The rows are inserted in batches which do not exceed the limit on the
+	// number of parameters.
+	orders = orders[:0]
+	for i := range sqlrange.CopyRowsMaxParams {
+		orders = append(orders, []driver.Value{int64(i), "item"})
+	}
+	queries, archive = nil, nil
+
+	n, err = sqlrange.CopyRows[item](context.Background(), db, db, sqlrange.Postgres,
+		`SELECT id, name FROM orders WHERE id <= $1`, "archive", nil, int64(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != sqlrange.CopyRowsMaxParams {
+		t.Errorf("expect %d rows copied, got %d", sqlrange.CopyRowsMaxParams, n)
+	}
+	if len(archive) != 3 || len(archive[0]) != 998 || len(archive[1]) != 998 || len(archive[2]) != 2 {
+		t.Errorf("wrong batches of %d statements", len(archive))
+	}
+	if !strings.HasPrefix(queries[0], `INSERT INTO "archive" ("id", "name") VALUES ($1, $2), `) {
+		t.Errorf("wrong query: %.100s", queries[0])
+	}
+}
+
+func TestCopyRowsTags(t *testing.T) {
+	type item struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name" sql:"label"`
+	}
+
+	var queries []string
+	var archive [][]driver.Value
+	db := sql.OpenDB(&stubConnector{
+		query: func(string, []driver.NamedValue) (driver.Rows, error) {
+			return newStubRows([]string{"id", "label"}, []driver.Value{int64(1), "apple"}), nil
+		},
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			queries = append(queries, query)
+			values := make([]driver.Value, len(args))
+			for i, arg := range args {
+				values[i] = arg.Value
+			}
+			archive = append(archive, values)
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+
+	ctx := sqlrange.WithTags(context.Background(), "sql", "db")
+	if _, err := sqlrange.CopyRows[item](ctx, db, db, sqlrange.Postgres, `SELECT id, label FROM items`, "archive", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []string{`INSERT INTO "archive" ("id", "label") VALUES ($1, $2)`}; !slices.Equal(queries, expect) {
+		t.Errorf("expect %q, got %q", expect, queries)
+	}
+	if expect := [][]driver.Value{{int64(1), "apple"}}; !slices.EqualFunc(archive, expect, slices.Equal) {
+		t.Errorf("expect %v, got %v", expect, archive)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	type greeting struct {
+		Text string `sql:"text"`
+		Age  int    `sql:"age"`
+	}
+
+	src := newTestDB(t, "people")
+	defer src.Close()
+
+	var written [][]driver.Value
+	dst := sql.OpenDB(&stubConnector{
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			if query != `INSERT INTO greetings (text, age) VALUES (?, ?)` {
+				return nil, fmt.Errorf("unexpected query: %s", query)
+			}
+			values := make([]driver.Value, len(args))
+			for i, arg := range args {
+				values[i] = arg.Value
+			}
+			written = append(written, values)
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer dst.Close()
+
+	greet := func(p person) (greeting, error) {
+		return greeting{Text: "Hello " + p.Name, Age: p.Age * 10}, nil
+	}
+
+	err := sqlrange.Pipe(context.Background(), src, `SELECT|people|age,name|`,
+		dst, `INSERT INTO greetings (text, age) VALUES (?, ?)`, greet,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := [][]driver.Value{
+		{"Hello Alice", int64(10)},
+		{"Hello Bob", int64(20)},
+		{"Hello Chris", int64(30)},
+	}
+	if !slices.EqualFunc(written, expect, slices.Equal) {
+		t.Errorf("expect %v, got %v", expect, written)
+	}
+
+	written = nil
+	errBroken := errors.New("broken")
+	err = sqlrange.Pipe(context.Background(), src, `SELECT|people|age,name|`,
+		dst, `INSERT INTO greetings (text, age) VALUES (?, ?)`,
+		func(p person) (greeting, error) {
+			if p.Name == "Bob" {
+				return greeting{}, errBroken
+			}
+			return greet(p)
+		},
+	)
+	if !errors.Is(err, errBroken) {
+		t.Errorf("expect %v, got %v", errBroken, err)
+	}
+	if len(written) != 1 {
+		t.Errorf("expect 1 row written before the error, got %d", len(written))
+	}
+}
+
+func TestInsertProgress(t *testing.T) {
+	var queries []string
+	var inserted []driver.Value
+	db := sql.OpenDB(&stubConnector{
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			queries = append(queries, query)
+			for _, arg := range args {
+				inserted = append(inserted, arg.Value)
+			}
+			return driver.RowsAffected(len(args) / 2), nil
+		},
+	})
+	defer db.Close()
+
+	type item struct {
+		ID   int64  `sql:"id"`
+		Name string `sql:"name"`
+	}
+
+	items := func(yield func(item, error) bool) {
+		for i := range int64(5) {
+			if !yield(item{ID: i, Name: strconv.Itoa(int(i))}, nil) {
+				return
+			}
+		}
+	}
+
+	var progress []int64
+	n, err := sqlrange.InsertProgress(context.Background(), db, sqlrange.Postgres, "items", items, 2,
+		func(n int64) { progress = append(progress, n) },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("expect 5 rows inserted, got %d", n)
+	}
+	if expect := []int64{2, 4, 5}; !slices.Equal(progress, expect) {
+		t.Errorf("expect progress %v, got %v", expect, progress)
+	}
+
+	const batch = `INSERT INTO "items" ("id", "name") VALUES ($1, $2), ($3, $4)`
+	const last = `INSERT INTO "items" ("id", "name") VALUES ($1, $2)`
+	if expect := []string{batch, batch, last}; !slices.Equal(queries, expect) {
+		t.Errorf("expect %q, got %q", expect, queries)
+	}
+	if len(inserted) != 10 || inserted[8] != int64(4) || inserted[9] != "4" {
+		t.Errorf("wrong inserted values: %v", inserted)
+	}
+
+	queries, progress = nil, nil
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n, err = sqlrange.InsertProgress(ctx, db, sqlrange.Postgres, "items", items, 2,
+		func(n int64) {
+			progress = append(progress, n)
+			if n == 2 {
+				cancel()
+			}
+		},
+	)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expect context.Canceled, got %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expect 2 rows inserted before the cancellation, got %d", n)
+	}
+	if len(queries) != 1 {
+		t.Errorf("expect 1 batch executed, got %d", len(queries))
+	}
+	if expect := []int64{2}; !slices.Equal(progress, expect) {
+		t.Errorf("expect progress %v, got %v", expect, progress)
+	}
+}
+
+func TestInsertProgressTags(t *testing.T) {
+	type item struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name" sql:"label"`
+	}
+
+	var queries []string
+	db := sql.OpenDB(&stubConnector{
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			queries = append(queries, query)
+			return driver.RowsAffected(len(args) / 2), nil
+		},
+	})
+	defer db.Close()
+
+	ctx := sqlrange.WithTags(context.Background(), "sql", "db")
+	items := sqlrange.Seq2FromSeq(slices.Values([]item{{1, "apple"}}))
+	if _, err := sqlrange.InsertProgress(ctx, db, sqlrange.Postgres, "items", items, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{`INSERT INTO "items" ("id", "label") VALUES ($1, $2)`}; !slices.Equal(queries, expect) {
+		t.Errorf("expect %q, got %q", expect, queries)
+	}
+
+	type untagged struct{ ID int64 }
+	n, err := sqlrange.InsertProgress(context.Background(), db, sqlrange.Postgres, "items",
+		sqlrange.Seq2FromSeq(slices.Values([]untagged{{1}})), 2, nil,
+	)
+	if err == nil || n != 0 {
+		t.Errorf("expect an error for a type without columns, got %d (%v)", n, err)
+	}
+	if len(queries) != 1 {
+		t.Errorf("expect no query executed for a type without columns, got %q", queries[1:])
+	}
+}
+
+func TestInsertReturning(t *testing.T) {
+	type user struct {
+		ID   int64  `sql:"id"`
+		Name string `sql:"name"`
+	}
+
+	users := []user{{Name: "Alice"}, {Name: "Bob"}}
+
+	t.Run("returning", func(t *testing.T) {
+		var queries []string
+		db := sql.OpenDB(&stubConnector{
+			query: func(query string, args []driver.NamedValue) (driver.Rows, error) {
+				queries = append(queries, query)
+				return newStubRows([]string{"id", "name"},
+					[]driver.Value{int64(len(queries)), args[0].Value},
+				), nil
+			},
+		})
+		defer db.Close()
+
+		rows, err := sqlrange.Collect(sqlrange.InsertReturning(context.Background(), db, db,
+			sqlrange.Postgres, "users", "id", sqlrange.Seq2FromSeq(slices.Values(users)),
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []user{{1, "Alice"}, {2, "Bob"}}; !slices.Equal(rows, expect) {
+			t.Errorf("expect %v, got %v", expect, rows)
+		}
+
+		const query = `INSERT INTO "users" ("name") VALUES ($1) RETURNING "id", "name"`
+		if expect := []string{query, query}; !slices.Equal(queries, expect) {
+			t.Errorf("expect %q, got %q", expect, queries)
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		type account struct {
+			ID   int64  `db:"id"`
+			Name string `db:"name" sql:"login"`
+		}
+
+		var queries []string
+		db := sql.OpenDB(&stubConnector{
+			query: func(query string, args []driver.NamedValue) (driver.Rows, error) {
+				queries = append(queries, query)
+				return newStubRows([]string{"id", "login"},
+					[]driver.Value{int64(1), args[0].Value},
+				), nil
+			},
+		})
+		defer db.Close()
+
+		ctx := sqlrange.WithTags(context.Background(), "sql", "db")
+		rows, err := sqlrange.Collect(sqlrange.InsertReturning(ctx, db, db,
+			sqlrange.Postgres, "accounts", "id", sqlrange.Seq2FromSeq(slices.Values([]account{{Name: "alice"}})),
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []account{{1, "alice"}}; !slices.Equal(rows, expect) {
+			t.Errorf("expect %v, got %v", expect, rows)
+		}
+
+		const query = `INSERT INTO "accounts" ("login") VALUES ($1) RETURNING "id", "login"`
+		if expect := []string{query}; !slices.Equal(queries, expect) {
+			t.Errorf("expect %q, got %q", expect, queries)
+		}
+	})
+
+	t.Run("last insert id", func(t *testing.T) {
+		var queries []string
+		var table []string
+		db := sql.OpenDB(&stubConnector{
+			exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+				queries = append(queries, query)
+				table = append(table, args[0].Value.(string))
+				return stubResult(len(table)), nil
+			},
+			query: func(query string, args []driver.NamedValue) (driver.Rows, error) {
+				queries = append(queries, query)
+				id := args[0].Value.(int64)
+				return newStubRows([]string{"id", "name"},
+					[]driver.Value{id, table[id-1]},
+				), nil
+			},
+		})
+		defer db.Close()
+
+		// The context hooks apply to the insert and select queries.
+		ctx := sqlrange.WithQueryRewriter(context.Background(), func(_ context.Context, query string) (string, error) {
+			return "/* app */ " + query, nil
+		})
+
+		rows, err := sqlrange.Collect(sqlrange.InsertReturning(ctx, db, db,
+			sqlrange.MySQL, "users", "id", sqlrange.Seq2FromSeq(slices.Values(users)),
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []user{{1, "Alice"}, {2, "Bob"}}; !slices.Equal(rows, expect) {
+			t.Errorf("expect %v, got %v", expect, rows)
+		}
+
+		const insert = "/* app */ INSERT INTO `users` (`name`) VALUES (?)"
+		const select_ = "/* app */ SELECT `id`, `name` FROM `users` WHERE `id` = ?"
+		if expect := []string{insert, select_, insert, select_}; !slices.Equal(queries, expect) {
+			t.Errorf("expect %q, got %q", expect, queries)
+		}
+	})
+
+	t.Run("missing row", func(t *testing.T) {
+		db := sql.OpenDB(&stubConnector{
+			exec: func(string, []driver.NamedValue) (driver.Result, error) {
+				return stubResult(1), nil
+			},
+			query: func(string, []driver.NamedValue) (driver.Rows, error) {
+				return newStubRows([]string{"id", "name"}), nil
+			},
+		})
+		defer db.Close()
+
+		_, err := sqlrange.Collect(sqlrange.InsertReturning(context.Background(), db, db,
+			sqlrange.MySQL, "users", "id", sqlrange.Seq2FromSeq(slices.Values(users)),
+		))
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expect sql.ErrNoRows, got %v", err)
+		}
+	})
+}
+
+func TestScanMaps(t *testing.T) {
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"id", "name", "score", "active"},
+			[]driver.Value{int64(1), []byte("Alice"), 4.5, true},
+			[]driver.Value{int64(2), "Bob", float64(3), false},
+		), nil
+	})
+	defer db.Close()
+	const query = `SELECT id, name, score, active FROM players`
+
+	var anys []map[string]any
+	for m, err := range sqlrange.Query[map[string]any](db, query) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		anys = append(anys, m)
+	}
+	expectAnys := []map[string]any{
+		{"id": int64(1), "name": []byte("Alice"), "score": 4.5, "active": true},
+		{"id": int64(2), "name": "Bob", "score": float64(3), "active": false},
+	}
+	if !reflect.DeepEqual(anys, expectAnys) {
+		t.Errorf("expect %v, got %v", expectAnys, anys)
+	}
+
+	var texts []map[string]string
+	for m, err := range sqlrange.Query[map[string]string](db, query) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, m)
+	}
+	expectTexts := []map[string]string{
+		{"id": "1", "name": "Alice", "score": "4.5", "active": "true"},
+		{"id": "2", "name": "Bob", "score": "3", "active": "false"},
+	}
+	if !slices.EqualFunc(texts, expectTexts, maps.Equal) {
+		t.Errorf("expect %v, got %v", expectTexts, texts)
+	}
+
+	for _, err := range sqlrange.Query[map[string]int64](db, query) {
+		if err == nil {
+			t.Fatal("expect an error scanning a text column into map[string]int64")
+		}
+		if !strings.Contains(err.Error(), `column "name"`) {
+			t.Errorf("expect the error to name the column, got %v", err)
+		}
+	}
+}
+
+func TestTextMarshaler(t *testing.T) {
+	type host struct {
+		Name string `sql:"name"`
+		IP   net.IP `sql:"ip"`
+	}
+
+	db := newTestDB(t, "")
+	defer db.Close()
+	exec(t, db, "CREATE|hosts|name=string,ip=string")
+
+	hosts := []host{
+		{Name: "localhost", IP: net.IPv4(127, 0, 0, 1)},
+		{Name: "example", IP: net.ParseIP("2001:db8::1")},
+	}
+
+	for _, err := range sqlrange.ExecSlice(context.Background(), db, `INSERT|hosts|name=?,ip=?`, hosts) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var texts []string
+	for text, err := range sqlrange.Query[struct {
+		IP string `sql:"ip"`
+	}](db, `SELECT|hosts|ip|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, text.IP)
+	}
+	if expect := []string{"127.0.0.1", "2001:db8::1"}; !slices.Equal(texts, expect) {
+		t.Errorf("expect %q, got %q", expect, texts)
+	}
+
+	var results []host
+	for h, err := range sqlrange.Query[host](db, `SELECT|hosts|name,ip|`) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, h)
+	}
+	if !slices.EqualFunc(results, hosts, func(a, b host) bool {
+		return a.Name == b.Name && a.IP.Equal(b.IP)
+	}) {
+		t.Errorf("expect %v, got %v", hosts, results)
+	}
+}
+
+func TestQueryCounted(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer db.Close()
+
+	rows, count := sqlrange.QueryCounted[person](context.Background(), db, `SELECT|people|age,name|`)
+	if n := count(); n != 0 {
+		t.Errorf("expect no rows before the iteration, got %d", n)
+	}
+
+	var names []string
+	for p, err := range rows {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, p.Name)
+		if n := count(); n != len(names) {
+			t.Errorf("expect %d rows during the iteration, got %d", len(names), n)
+		}
+	}
+
+	if n := count(); n != 3 {
+		t.Errorf("expect 3 rows after the iteration, got %d", n)
+	}
+	if expect := []string{"Alice", "Bob", "Chris"}; !slices.Equal(names, expect) {
+		t.Errorf("expect %q, got %q", expect, names)
+	}
+}
+
+func TestStructFieldScanner(t *testing.T) {
+	type place struct {
+		Name     string `sql:"name"`
+		Location Point  `sql:"location"`
+		Previous *Point `sql:"previous"`
+		Ignored  Point
+	}
+
+	var columns []string
+	for columnName := range sqlrange.Fields(reflect.TypeFor[place]()) {
+		columns = append(columns, columnName)
+	}
+	if expect := []string{"name", "location", "previous"}; !slices.Equal(columns, expect) {
+		t.Errorf("expect %v, got %v", expect, columns)
+	}
+
+	db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+		return newStubRows([]string{"name", "location", "previous"},
+			[]driver.Value{"home", "1,2", nil},
+			[]driver.Value{"work", "3,4", "1,2"},
+		), nil
+	})
+	defer db.Close()
+
+	places, err := sqlrange.Collect(sqlrange.Query[place](db, `SELECT name, location, previous FROM places`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(places) != 2 {
+		t.Fatalf("expect 2 places, got %d", len(places))
+	}
+	if p := places[0]; p.Name != "home" || p.Location != (Point{X: 1, Y: 2}) || p.Previous != nil {
+		t.Errorf("unexpected first place: %+v", p)
+	}
+	if p := places[1]; p.Name != "work" || p.Location != (Point{X: 3, Y: 4}) || p.Previous == nil || *p.Previous != (Point{X: 1, Y: 2}) {
+		t.Errorf("unexpected second place: %+v", p)
+	}
+}
+
+func TestScanComputedColumns(t *testing.T) {
+	type answer struct {
+		Name   string `sql:"name"`
+		Answer int64  `sql:"answer"`
+		Total  int64  `sql:"total"`
+	}
+
+	var queries []string
+	db := newStubDB(func(query string, _ []driver.NamedValue) (driver.Rows, error) {
+		queries = append(queries, query)
+		// Drivers report the aliases of computed columns as their names.
+		return newStubRows([]string{"name", "answer", "total"},
+			[]driver.Value{"Alice", int64(1), int64(42)},
+		), nil
+	})
+	defer db.Close()
+
+	const query = `SELECT name, 1 AS answer, COUNT(*) AS total FROM people GROUP BY name`
+	rows, err := sqlrange.Collect(sqlrange.Query[answer](db, query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []answer{{"Alice", 1, 42}}; !slices.Equal(rows, expect) {
+		t.Errorf("expect %v, got %v", expect, rows)
+	}
+	if expect := []string{query}; !slices.Equal(queries, expect) {
+		t.Errorf("expect %q, got %q", expect, queries)
+	}
+}
+
+// money is a custom argument type that only the stub driver of
+// TestExecNamedValueChecker supports.
+type money struct {
+	units int64
+	cents int64
+}
+
+func TestExecNamedValueChecker(t *testing.T) {
+	type payment struct {
+		ID     int64  `sql:"id"`
+		Amount money  `sql:"amount"`
+		Refund *money `sql:"refund"`
+	}
+
+	var execArgs [][]driver.Value
+	db := sql.OpenDB(&stubConnector{
+		check: func(arg *driver.NamedValue) error {
+			switch v := arg.Value.(type) {
+			case money:
+				arg.Value = fmt.Sprintf("%d.%02d", v.units, v.cents)
+				return nil
+			case *money:
+				if v == nil {
+					arg.Value = nil
+				} else {
+					arg.Value = fmt.Sprintf("-%d.%02d", v.units, v.cents)
+				}
+				return nil
+			}
+			return driver.ErrSkip
+		},
+		exec: func(query string, args []driver.NamedValue) (driver.Result, error) {
+			values := make([]driver.Value, len(args))
+			for i, arg := range args {
+				values[i] = arg.Value
+			}
+			execArgs = append(execArgs, values)
+			return driver.RowsAffected(1), nil
+		},
+	})
+	defer db.Close()
+
+	payments := []payment{
+		{ID: 1, Amount: money{12, 50}},
+		{ID: 2, Amount: money{3, 0}, Refund: &money{1, 5}},
+	}
+
+	for _, err := range sqlrange.ExecSlice(context.Background(), db, `INSERT INTO payments VALUES (?, ?, ?)`, payments) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := [][]driver.Value{
+		{int64(1), "12.50", nil},
+		{int64(2), "3.00", "-1.05"},
+	}
+	if !slices.EqualFunc(execArgs, expect, slices.Equal) {
+		t.Errorf("expect %v, got %v", expect, execArgs)
+	}
+}
+
+func TestScanAlias(t *testing.T) {
+	type user struct {
+		ID    int64  `sql:"id"`
+		Email string `sql:"email,alias=email_address,alias=mail"`
+	}
+
+	for _, columns := range [][]string{
+		{"id", "email"},
+		{"id", "email_address"},
+		{"id", "mail"},
+		// The name of the field takes precedence over its aliases, and the
+		// first alias over the next ones.
+		{"mail", "id", "email_address", "email"},
+		{"mail", "id", "email_address"},
+	} {
+		db := newStubDB(func(string, []driver.NamedValue) (driver.Rows, error) {
+			values := make([]driver.Value, len(columns))
+			for i, column := range columns {
+				values[i] = column
+				if column == "id" {
+					values[i] = int64(1)
+				}
+			}
+			return newStubRows(columns, values), nil
+		})
+		defer db.Close()
+
+		var users []user
+		for u, err := range sqlrange.Query[user](db, `SELECT * FROM users`, sqlrange.ScanOnlyFields("id", "email")) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			users = append(users, u)
+		}
+
+		expect := []user{{ID: 1, Email: columns[len(columns)-1]}}
+		if !slices.Equal(users, expect) {
+			t.Errorf("%q: expect %v, got %v", columns, expect, users)
+		}
+	}
+}
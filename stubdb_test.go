@@ -0,0 +1,126 @@
+package sqlrange_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+// stubConnector is a driver.Connector serving canned results, it is used by
+// tests that need control over the exact columns and values that a driver
+// reports, which the fake driver does not allow.
+type stubConnector struct {
+	query func(query string, args []driver.NamedValue) (driver.Rows, error)
+	exec  func(query string, args []driver.NamedValue) (driver.Result, error)
+	// check is called to validate the query arguments when it is not nil, the
+	// default conversions of database/sql apply otherwise.
+	check func(arg *driver.NamedValue) error
+	// tx is called with "commit" or "rollback" when transactions end, they are
+	// not supported when it is nil.
+	tx func(end string) error
+}
+
+func newStubDB(query func(string, []driver.NamedValue) (driver.Rows, error)) *sql.DB {
+	return sql.OpenDB(&stubConnector{query: query})
+}
+
+func (c *stubConnector) Connect(context.Context) (driver.Conn, error) {
+	return &stubConn{c}, nil
+}
+
+func (c *stubConnector) Driver() driver.Driver {
+	return stubDriver{c}
+}
+
+type stubDriver struct{ c *stubConnector }
+
+func (d stubDriver) Open(string) (driver.Conn, error) {
+	return &stubConn{d.c}, nil
+}
+
+type stubConn struct{ c *stubConnector }
+
+func (c *stubConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("stubdb: prepare not supported")
+}
+
+func (c *stubConn) Close() error {
+	return nil
+}
+
+func (c *stubConn) Begin() (driver.Tx, error) {
+	if c.c.tx == nil {
+		return nil, errors.New("stubdb: transactions not supported")
+	}
+	return stubTx{c.c}, nil
+}
+
+type stubTx struct{ c *stubConnector }
+
+func (tx stubTx) Commit() error   { return tx.c.tx("commit") }
+func (tx stubTx) Rollback() error { return tx.c.tx("rollback") }
+
+func (c *stubConn) CheckNamedValue(arg *driver.NamedValue) error {
+	if c.c.check == nil {
+		return driver.ErrSkip
+	}
+	return c.c.check(arg)
+}
+
+func (c *stubConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.c.query == nil {
+		return nil, errors.New("stubdb: query not supported")
+	}
+	return c.c.query(query, args)
+}
+
+func (c *stubConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.c.exec == nil {
+		return nil, errors.New("stubdb: exec not supported")
+	}
+	return c.c.exec(query, args)
+}
+
+// stubRows is a driver.Rows yielding a fixed list of values.
+//
+// When limit is negative, the rows are repeated indefinitely.
+type stubRows struct {
+	columns []string
+	values  [][]driver.Value
+	limit   int
+	index   int
+}
+
+func newStubRows(columns []string, values ...[]driver.Value) *stubRows {
+	return &stubRows{columns: columns, values: values, limit: len(values)}
+}
+
+func (r *stubRows) Columns() []string {
+	return r.columns
+}
+
+func (r *stubRows) Close() error {
+	return nil
+}
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.limit >= 0 && r.index >= r.limit {
+		return io.EOF
+	}
+	copy(dest, r.values[r.index%len(r.values)])
+	r.index++
+	return nil
+}
+
+// stubResult is a driver.Result reporting the id of an inserted row.
+type stubResult int64
+
+func (r stubResult) LastInsertId() (int64, error) {
+	return int64(r), nil
+}
+
+func (r stubResult) RowsAffected() (int64, error) {
+	return 1, nil
+}